@@ -0,0 +1,178 @@
+package formstream
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTooManyEntries is returned when the archive has more entries than WithMaxEntries.
+	ErrTooManyEntries = errors.New("too many archive entries")
+	// ErrArchiveTooLarge is returned when the entries exceed WithMaxTotalSize or WithMaxCompressionRatio.
+	ErrArchiveTooLarge = errors.New("archive too large")
+	// ErrUnsafeEntry is returned when an entry escapes the archive root or is not a regular file or directory.
+	ErrUnsafeEntry = errors.New("unsafe archive entry")
+)
+
+// ArchiveEntry is an entry of an archive.
+type ArchiveEntry struct {
+	// Name the slash-separated path of the entry, cleaned and guaranteed to stay inside the archive root.
+	Name    string
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+}
+
+// IsDir reports whether the entry is a directory.
+func (e ArchiveEntry) IsDir() bool {
+	return e.Mode.IsDir()
+}
+
+// ArchiveEntryFunc is called for each entry of an archive.
+// r reads the content of the entry. It is empty for directories.
+type ArchiveEntryFunc func(entry ArchiveEntry, r io.Reader) error
+
+type archiveConfig struct {
+	maxEntries          uint
+	maxTotalSize        DataSize
+	maxCompressionRatio float64
+}
+
+type ArchiveOption func(*archiveConfig)
+
+// WithMaxEntries sets the maximum number of entries in the archive.
+// default: 10000
+func WithMaxEntries(maxEntries uint) ArchiveOption {
+	return func(c *archiveConfig) {
+		c.maxEntries = maxEntries
+	}
+}
+
+// WithMaxTotalSize sets the maximum total size of the uncompressed entries.
+// default: 1GB
+func WithMaxTotalSize(maxTotalSize DataSize) ArchiveOption {
+	return func(c *archiveConfig) {
+		c.maxTotalSize = maxTotalSize
+	}
+}
+
+// WithMaxCompressionRatio sets the maximum ratio of the uncompressed size to the compressed size of each entry.
+// It applies to zip archives (see ZipHook), whose entries are compressed separately.
+// default: 100
+func WithMaxCompressionRatio(ratio float64) ArchiveOption {
+	return func(c *archiveConfig) {
+		c.maxCompressionRatio = ratio
+	}
+}
+
+func newArchiveConfig(options []ArchiveOption) *archiveConfig {
+	c := &archiveConfig{
+		maxEntries:          10000,
+		maxTotalSize:        1 * GB,
+		maxCompressionRatio: 100,
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+
+	return c
+}
+
+// gzipMagic is the first bytes of gzip data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// TarHook returns a hook that calls fn for each entry of the tar archive in the part, as the part streams.
+// Gzip compressed archives (.tar.gz) are decompressed transparently.
+// Entries other than regular files and directories (e.g. symbolic links) and entries whose path escapes the archive root
+// are rejected with ErrUnsafeEntry.
+// The hook fails with ErrTooManyEntries or ErrArchiveTooLarge as soon as a limit is exceeded,
+// before fn is called for the entry.
+func TarHook(fn ArchiveEntryFunc, options ...ArchiveOption) StreamHookFunc {
+	c := newArchiveConfig(options)
+
+	return func(r io.Reader, _ Header) error {
+		br := bufio.NewReader(r)
+		magic, err := br.Peek(len(gzipMagic))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to peek: %w", err)
+		}
+
+		var tr *tar.Reader
+		if bytes.Equal(magic, gzipMagic) {
+			gr, err := gzip.NewReader(br)
+			if err != nil {
+				return fmt.Errorf("failed to create gzip reader: %w", err)
+			}
+			defer gr.Close()
+
+			tr = tar.NewReader(gr)
+		} else {
+			tr = tar.NewReader(br)
+		}
+
+		var (
+			entries   uint
+			totalSize int64
+		)
+		for {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read tar header: %w", err)
+			}
+
+			entries++
+			if entries > c.maxEntries {
+				return ErrTooManyEntries
+			}
+
+			totalSize += header.Size
+			if DataSize(totalSize) > c.maxTotalSize {
+				return ErrArchiveTooLarge
+			}
+
+			switch header.Typeflag {
+			case tar.TypeReg, tar.TypeDir:
+			default:
+				return fmt.Errorf("%w: %s is not a regular file or directory", ErrUnsafeEntry, header.Name)
+			}
+
+			name, err := sanitizeEntryName(header.Name)
+			if err != nil {
+				return err
+			}
+
+			err = fn(ArchiveEntry{
+				Name:    name,
+				Size:    header.Size,
+				Mode:    header.FileInfo().Mode(),
+				ModTime: header.ModTime,
+			}, tr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sanitizeEntryName cleans the name of an archive entry and rejects the names escaping the archive root.
+func sanitizeEntryName(name string) (string, error) {
+	cleaned := path.Clean(name)
+	if cleaned == "." || strings.Contains(name, `\`) || !fs.ValidPath(cleaned) || !filepath.IsLocal(filepath.FromSlash(cleaned)) {
+		return "", fmt.Errorf("%w: %q", ErrUnsafeEntry, name)
+	}
+
+	return cleaned, nil
+}
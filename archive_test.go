@@ -0,0 +1,170 @@
+package formstream_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mazrean/formstream"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	content  string
+}
+
+func createTar(t *testing.T, entries []tarEntry, compress bool) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	var w io.Writer = buf
+	var gw *gzip.Writer
+	if compress {
+		gw = gzip.NewWriter(buf)
+		w = gw
+	}
+
+	tw := tar.NewWriter(w)
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Size:     int64(len(entry.content)),
+			Mode:     0o644,
+		}
+		if entry.typeflag == tar.TypeSymlink {
+			header.Linkname = "/etc/passwd"
+			header.Size = 0
+		}
+
+		err := tw.WriteHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write([]byte(entry.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gw != nil {
+		err = gw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func TestTarHook(t *testing.T) {
+	t.Parallel()
+
+	files := []tarEntry{
+		{name: "dir/", typeflag: tar.TypeDir},
+		{name: "dir/a.txt", typeflag: tar.TypeReg, content: "aaa"},
+		{name: "./b.txt", typeflag: tar.TypeReg, content: "bbbbb"},
+	}
+
+	tests := map[string]struct {
+		entries  []tarEntry
+		compress bool
+		options  []formstream.ArchiveOption
+		expected []string
+		err      error
+	}{
+		"tar": {
+			entries:  files,
+			expected: []string{"dir:", "dir/a.txt:aaa", "b.txt:bbbbb"},
+		},
+		"tar.gz": {
+			entries:  files,
+			compress: true,
+			expected: []string{"dir:", "dir/a.txt:aaa", "b.txt:bbbbb"},
+		},
+		"empty": {
+			entries: []tarEntry{},
+		},
+		"too many entries": {
+			entries:  files,
+			options:  []formstream.ArchiveOption{formstream.WithMaxEntries(2)},
+			expected: []string{"dir:", "dir/a.txt:aaa"},
+			err:      formstream.ErrTooManyEntries,
+		},
+		"too large": {
+			entries:  files,
+			compress: true,
+			options:  []formstream.ArchiveOption{formstream.WithMaxTotalSize(7)},
+			expected: []string{"dir:", "dir/a.txt:aaa"},
+			err:      formstream.ErrArchiveTooLarge,
+		},
+		"path traversal": {
+			entries: []tarEntry{{name: "../a.txt", typeflag: tar.TypeReg, content: "aaa"}},
+			err:     formstream.ErrUnsafeEntry,
+		},
+		"path traversal(nested)": {
+			entries: []tarEntry{{name: "dir/../../a.txt", typeflag: tar.TypeReg, content: "aaa"}},
+			err:     formstream.ErrUnsafeEntry,
+		},
+		"absolute path": {
+			entries: []tarEntry{{name: "/etc/passwd", typeflag: tar.TypeReg, content: "aaa"}},
+			err:     formstream.ErrUnsafeEntry,
+		},
+		"symlink": {
+			entries: []tarEntry{{name: "link", typeflag: tar.TypeSymlink}},
+			err:     formstream.ErrUnsafeEntry,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			data := createTar(t, tt.entries, tt.compress)
+
+			var actual []string
+			hook := formstream.TarHook(func(entry formstream.ArchiveEntry, r io.Reader) error {
+				content, err := io.ReadAll(r)
+				if err != nil {
+					return err
+				}
+
+				actual = append(actual, entry.Name+":"+string(content))
+
+				return nil
+			}, tt.options...)
+
+			err := hook(bytes.NewReader(data), formstream.Header{})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(actual, tt.expected) {
+				t.Errorf("unexpected entries: %v", actual)
+			}
+		})
+	}
+}
+
+func TestTarHook_invalid(t *testing.T) {
+	t.Parallel()
+
+	hook := formstream.TarHook(func(formstream.ArchiveEntry, io.Reader) error {
+		return nil
+	})
+
+	err := hook(strings.NewReader(strings.Repeat("a", 1024)), formstream.Header{})
+	if err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,43 @@
+package formstream
+
+import (
+	"context"
+	"io"
+)
+
+// BodyReader reads a body that is not a multipart form, e.g. the chunks of the tus protocol,
+// with the same limits of reading as Parser.
+// The options applied are WithIdleTimeout, WithMinThroughput, WithReadRateLimit, WithRateLimiter,
+// WithProgress and WithContentLength, and the others are ignored.
+// The errors of reading the body are reported as the errors of the client by StatusCode.
+type BodyReader struct {
+	r      io.Reader
+	parser *Parser
+	stop   func()
+}
+
+// NewBodyReader returns the BodyReader reading r until ctx is done.
+// It must be closed after reading.
+func NewBodyReader(ctx context.Context, r io.Reader, options ...ParserOption) *BodyReader {
+	parser := NewParser("", options...)
+	r, stop := parser.limitReader(ctx, r)
+
+	return &BodyReader{
+		r:      bodyReader{r: r},
+		parser: parser,
+		stop:   stop,
+	}
+}
+
+func (br *BodyReader) Read(p []byte) (int, error) {
+	return br.r.Read(p)
+}
+
+// Close stops reading the body and reports the last progress.
+// It does not close the underlying reader.
+func (br *BodyReader) Close() error {
+	br.stop()
+	br.parser.progress.finish()
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package formstream_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mazrean/formstream"
+)
+
+func TestBodyReader(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		options []formstream.ParserOption
+		// interval the interval between the chunks of 100 bytes the client sends
+		interval       time.Duration
+		canceled       bool
+		err            error
+		expectedStatus int
+	}{
+		"normal": {},
+		"idle": {
+			options:        []formstream.ParserOption{formstream.WithIdleTimeout(50 * time.Millisecond)},
+			interval:       time.Second,
+			err:            formstream.ErrClientTooSlow,
+			expectedStatus: http.StatusRequestTimeout,
+		},
+		"canceled": {
+			canceled:       true,
+			err:            context.Canceled,
+			expectedStatus: formstream.StatusClientClosedRequest,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			body := strings.Repeat("a", 1000)
+
+			pr, pw := io.Pipe()
+			go func() {
+				for i := 0; i < len(body); i += 100 {
+					_, err := pw.Write([]byte(body[i : i+100]))
+					if err != nil {
+						return
+					}
+					time.Sleep(tt.interval)
+				}
+				pw.Close()
+			}()
+			defer pr.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.canceled {
+				cancel()
+			}
+
+			var progress formstream.Progress
+			options := append([]formstream.ParserOption{
+				formstream.WithProgress(func(p formstream.Progress) {
+					progress = p
+				}, time.Hour),
+			}, tt.options...)
+
+			br := formstream.NewBodyReader(ctx, pr, options...)
+			data, err := io.ReadAll(br)
+			closeErr := br.Close()
+			if closeErr != nil {
+				t.Fatalf("failed to close: %v", closeErr)
+			}
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				if code := formstream.StatusCode(err); code != tt.expectedStatus {
+					t.Errorf("unexpected status code: expected %d, actual %d", tt.expectedStatus, code)
+				}
+				return
+			}
+
+			if string(data) != body {
+				t.Errorf("unexpected data: %q", data)
+			}
+			if progress.BytesRead != int64(len(body)) {
+				t.Errorf("unexpected progress: %+v", progress)
+			}
+		})
+	}
+}
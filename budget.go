@@ -0,0 +1,242 @@
+package formstream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrBudgetExceeded is returned when the Budget has no room for the data to buffer.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// errBudgetSpill is returned by Budget when the data should be buffered on disk instead of memory.
+var errBudgetSpill = errors.New("budget spill")
+
+// BudgetPolicy is the behavior when the Budget has no room.
+type BudgetPolicy int
+
+const (
+	// BudgetBlock waits until other parsers release enough room, or until the context of the parsing is done.
+	// If the data can never fit, i.e. it is larger than the whole budget except the room the parser itself holds,
+	// it fails with ErrBudgetExceeded.
+	BudgetBlock BudgetPolicy = iota
+	// BudgetSpill buffers the data on disk instead of memory.
+	// If the disk budget has no room, it fails with ErrBudgetExceeded.
+	BudgetSpill
+	// BudgetFail fails with ErrBudgetExceeded.
+	BudgetFail
+)
+
+// Budget is the memory and disk size shared by the parsers.
+// Parsers reserve the size of the parts buffered on memory or disk from the Budget, and release it when the parts are no longer needed.
+// A Budget is safe for concurrent use.
+type Budget struct {
+	policy      BudgetPolicy
+	maxMemSize  DataSize
+	maxDiskSize DataSize
+
+	locker sync.Mutex
+	// released is closed when room is released, to wake up the waiting parsers
+	released chan struct{}
+	memSize  DataSize
+	diskSize DataSize
+}
+
+// NewBudget creates a Budget with the maximum memory and disk sizes.
+func NewBudget(maxMemSize DataSize, maxDiskSize DataSize, policy BudgetPolicy) *Budget {
+	return &Budget{
+		policy:      policy,
+		maxMemSize:  maxMemSize,
+		maxDiskSize: maxDiskSize,
+		released:    make(chan struct{}),
+	}
+}
+
+// InUse returns the memory and disk sizes reserved by the parsers.
+func (b *Budget) InUse() (memSize DataSize, diskSize DataSize) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	return b.memSize, b.diskSize
+}
+
+// reserveMemory reserves size bytes of memory.
+// held is the memory the parser already holds, which is not released while it waits.
+func (b *Budget) reserveMemory(ctx context.Context, size DataSize, held DataSize) error {
+	return b.reserve(ctx, &b.memSize, b.maxMemSize, size, held, b.policy == BudgetSpill)
+}
+
+func (b *Budget) releaseMemory(size DataSize) {
+	b.release(&b.memSize, size)
+}
+
+// reserveDisk reserves size bytes of disk.
+// held is the disk the parser already holds, which is not released while it waits.
+func (b *Budget) reserveDisk(ctx context.Context, size DataSize, held DataSize) error {
+	return b.reserve(ctx, &b.diskSize, b.maxDiskSize, size, held, false)
+}
+
+func (b *Budget) releaseDisk(size DataSize) {
+	b.release(&b.diskSize, size)
+}
+
+func (b *Budget) reserve(ctx context.Context, used *DataSize, limit DataSize, size DataSize, held DataSize, spill bool) error {
+	for {
+		b.locker.Lock()
+		if *used+size <= limit {
+			*used += size
+			b.locker.Unlock()
+
+			return nil
+		}
+
+		released := b.released
+		b.locker.Unlock()
+
+		switch {
+		case spill:
+			return errBudgetSpill
+		case b.policy != BudgetBlock, size > limit-held:
+			// the room held by the parser is not released while it waits
+			return ErrBudgetExceeded
+		}
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *Budget) release(used *DataSize, size DataSize) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	*used -= size
+	close(b.released)
+	b.released = make(chan struct{})
+}
+
+// WithBudget makes the parser reserve the memory and disk for buffering the parts from the Budget shared with other parsers.
+// The memory for the values of the fields is reserved while parsing, and released when Parse returns.
+// The limits of the parser (WithMaxMemSize, WithMaxMemFileSize) are also applied.
+func WithBudget(budget *Budget) ParserOption {
+	return func(c *parserConfig) {
+		c.budget = budget
+	}
+}
+
+// reserveMemory reserves the memory from the budget.
+// It returns false if the data should be buffered on disk instead.
+func (pp *preProcessor) reserveMemory(size DataSize) (bool, error) {
+	if pp.config.budget == nil {
+		return true, nil
+	}
+
+	err := pp.config.budget.reserveMemory(pp.ctx, size, pp.memReserved)
+	if errors.Is(err, errBudgetSpill) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	pp.memReserved += size
+
+	return true, nil
+}
+
+func (pp *preProcessor) releaseMemory(size DataSize) {
+	if pp.config.budget == nil {
+		return
+	}
+
+	pp.memReserved -= size
+	pp.config.budget.releaseMemory(size)
+}
+
+// reserveValue reserves the memory for a value from the budget.
+// Values are kept on memory, so it fails with ErrBudgetExceeded instead of spilling.
+func (pp *preProcessor) reserveValue(size DataSize) error {
+	reserved, err := pp.reserveMemory(size)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return ErrBudgetExceeded
+	}
+	pp.valueReserved += size
+
+	return nil
+}
+
+// reserveDisk reserves the disk from the budget.
+func (pp *preProcessor) reserveDisk(size DataSize) error {
+	if pp.config.budget == nil {
+		return nil
+	}
+
+	err := pp.config.budget.reserveDisk(pp.ctx, size, pp.diskReserved)
+	if err != nil {
+		return err
+	}
+	pp.diskReserved += size
+
+	return nil
+}
+
+func (pp *preProcessor) releaseDisk(size DataSize) {
+	if pp.config.budget == nil {
+		return
+	}
+
+	pp.diskReserved -= size
+	pp.config.budget.releaseDisk(size)
+}
+
+// memoryWriter writes to buf, reserving the memory from the budget before buf grows,
+// so that the budget limits the memory actually used, not only the parts kept.
+// If the budget asks to buffer on disk instead, it writes p without reservation and fails with errBudgetSpill,
+// so that no data is lost and the caller can move buf to disk.
+type memoryWriter struct {
+	pp  *preProcessor
+	buf *bytes.Buffer
+	// reserved the size reserved from the budget
+	reserved DataSize
+}
+
+func (w *memoryWriter) Write(p []byte) (int, error) {
+	if size := DataSize(w.buf.Len()+len(p)) - w.reserved; size > 0 {
+		reserved, err := w.pp.reserveMemory(size)
+		if err != nil {
+			return 0, err
+		}
+		if !reserved {
+			n, _ := w.buf.Write(p)
+			return n, errBudgetSpill
+		}
+		w.reserved += size
+	}
+
+	return w.buf.Write(p)
+}
+
+// diskWriter writes to the temp file within the budget.
+type diskWriter struct {
+	pp   *preProcessor
+	file *spillFile
+}
+
+func (w diskWriter) Write(p []byte) (int, error) {
+	err := w.pp.reserveDisk(DataSize(len(p)))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.file.file.Write(p)
+	w.file.diskSize += DataSize(n)
+	w.pp.releaseDisk(DataSize(len(p) - n))
+
+	return n, err
+}
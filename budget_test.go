@@ -0,0 +1,347 @@
+package formstream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBudget_reserve(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		policy BudgetPolicy
+		size   DataSize
+		held   DataSize
+		err    error
+	}{
+		"fail": {
+			policy: BudgetFail,
+			size:   1,
+			err:    ErrBudgetExceeded,
+		},
+		"spill": {
+			policy: BudgetSpill,
+			size:   1,
+			err:    errBudgetSpill,
+		},
+		"block(too large)": {
+			policy: BudgetBlock,
+			size:   11,
+			err:    ErrBudgetExceeded,
+		},
+		"block(held by itself)": {
+			policy: BudgetBlock,
+			size:   1,
+			held:   10,
+			err:    ErrBudgetExceeded,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			b := NewBudget(10, 10, tt.policy)
+
+			err := b.reserveMemory(context.Background(), 10, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err = b.reserveMemory(context.Background(), tt.size, tt.held)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if memSize, _ := b.InUse(); memSize != 10 {
+				t.Errorf("unexpected memory size: %d", memSize)
+			}
+		})
+	}
+}
+
+func TestBudget_block(t *testing.T) {
+	t.Parallel()
+
+	b := NewBudget(10, 10, BudgetBlock)
+
+	err := b.reserveDisk(context.Background(), 10, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reserved := make(chan error)
+	go func() {
+		reserved <- b.reserveDisk(context.Background(), 5, 0)
+	}()
+
+	select {
+	case <-reserved:
+		t.Fatal("reserved without release")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	b.releaseDisk(10)
+
+	select {
+	case err := <-reserved:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not reserved after release")
+	}
+
+	if _, diskSize := b.InUse(); diskSize != 5 {
+		t.Errorf("unexpected disk size: %d", diskSize)
+	}
+}
+
+func TestWithBudget(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		budget     *Budget
+		parts      int
+		partSize   int
+		noField    bool
+		fieldValue string
+		err        error
+	}{
+		"enough": {
+			budget: NewBudget(1*KB, 1*KB, BudgetFail),
+		},
+		"spill": {
+			// room only for the value of the field
+			budget: NewBudget(64, 1*KB, BudgetSpill),
+		},
+		"fail": {
+			budget: NewBudget(0, 1*KB, BudgetFail),
+			err:    ErrBudgetExceeded,
+		},
+		"fail(disk)": {
+			budget: NewBudget(0, 10, BudgetSpill),
+			err:    ErrBudgetExceeded,
+		},
+		"value": {
+			budget:     NewBudget(10, 10, BudgetFail),
+			fieldValue: strings.Repeat("v", 1000),
+			err:        ErrBudgetExceeded,
+		},
+		"value(spill)": {
+			budget:     NewBudget(500, 1*KB, BudgetSpill),
+			fieldValue: strings.Repeat("v", 1000),
+			err:        ErrBudgetExceeded,
+		},
+		"hook never runs": {
+			budget:  NewBudget(1*MB, 1*MB, BudgetFail),
+			noField: true,
+		},
+		"block(held by itself)": {
+			budget:   NewBudget(1*KB, 1*KB, BudgetBlock),
+			parts:    2,
+			partSize: 600,
+			err:      ErrBudgetExceeded,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sb := &strings.Builder{}
+			mw := multipart.NewWriter(sb)
+			err := mw.SetBoundary("boundary")
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts, partSize := max(tt.parts, 1), tt.partSize
+			if partSize == 0 {
+				partSize = 100
+			}
+			for range parts {
+				err = mw.WriteField("stream", strings.Repeat("a", partSize))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !tt.noField {
+				fieldValue := tt.fieldValue
+				if fieldValue == "" {
+					fieldValue = "value"
+				}
+				err = mw.WriteField("field", fieldValue)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = mw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parser := NewParser("boundary", WithBudget(tt.budget))
+			err = parser.Register("stream", func(r io.Reader, _ Header) error {
+				_, err := io.Copy(io.Discard, r)
+				return err
+			}, WithRequiredPart("field"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(strings.NewReader(sb.String()))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			memSize, diskSize := tt.budget.InUse()
+			if memSize != 0 || diskSize != 0 {
+				t.Errorf("budget is not released: memory %d, disk %d", memSize, diskSize)
+			}
+		})
+	}
+}
+
+func TestWithBudget_cancel(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		reserve func(b *Budget) error
+		options []ParserOption
+	}{
+		"memory": {
+			reserve: func(b *Budget) error {
+				return b.reserveMemory(context.Background(), 1*KB, 0)
+			},
+		},
+		"disk": {
+			reserve: func(b *Budget) error {
+				return b.reserveDisk(context.Background(), 1*KB, 0)
+			},
+			options: []ParserOption{WithMaxMemFileSize(10)},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			budget := NewBudget(1*KB, 1*KB, BudgetBlock)
+			// held by another parser
+			err := tt.reserve(budget)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sb := &strings.Builder{}
+			mw := multipart.NewWriter(sb)
+			err = mw.SetBoundary("boundary")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.WriteField("stream", strings.Repeat("a", 100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.WriteField("field", "value")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parser := NewParser("boundary", append(tt.options, WithBudget(budget))...)
+			err = parser.Register("stream", func(r io.Reader, _ Header) error {
+				_, err := io.Copy(io.Discard, r)
+				return err
+			}, WithRequiredPart("field"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			done := make(chan error, 1)
+			go func() {
+				done <- parser.ParseContext(ctx, strings.NewReader(sb.String()))
+			}()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("unexpected error: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("waiting for the budget is not canceled")
+			}
+
+			memSize, diskSize := budget.InUse()
+			if memSize+diskSize != 1*KB {
+				t.Errorf("budget is not released: memory %d, disk %d", memSize, diskSize)
+			}
+		})
+	}
+}
+
+func TestMemoryWriter(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		policy   BudgetPolicy
+		err      error
+		expected string
+	}{
+		"spill": {
+			policy: BudgetSpill,
+			err:    errBudgetSpill,
+			// the data is kept to be moved to disk
+			expected: "12345678901",
+		},
+		"fail": {
+			policy:   BudgetFail,
+			err:      ErrBudgetExceeded,
+			expected: "12345",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			budget := NewBudget(10, 10, tt.policy)
+			pp := &preProcessor{
+				config: &parserConfig{budget: budget},
+				ctx:    context.Background(),
+			}
+			mw := &memoryWriter{pp: pp, buf: new(bytes.Buffer)}
+
+			_, err := mw.Write([]byte("12345"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if memSize, _ := budget.InUse(); memSize != 5 {
+				t.Errorf("unexpected memory size: %d", memSize)
+			}
+
+			_, err = mw.Write([]byte("678901"))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if mw.buf.String() != tt.expected {
+				t.Errorf("unexpected buffer: %s", mw.buf.String())
+			}
+			if memSize, _ := budget.InUse(); memSize != 5 || mw.reserved != 5 {
+				t.Errorf("unexpected reservation: budget %d, writer %d", memSize, mw.reserved)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package formstream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrHookDidNotConsume is returned when a stream hook returns without reading the part to the end
+// and the UnconsumedPolicy does not allow it.
+var ErrHookDidNotConsume = errors.New("hook did not consume the part")
+
+type unconsumedAction int
+
+const (
+	unconsumedActionDrain unconsumedAction = iota
+	unconsumedActionDrainLimit
+	unconsumedActionFail
+)
+
+// UnconsumedPolicy is the policy for the rest of a part left unread by a stream hook.
+type UnconsumedPolicy struct {
+	action unconsumedAction
+	limit  DataSize
+}
+
+var (
+	// DrainUnconsumed discards the rest of the part.
+	DrainUnconsumed = UnconsumedPolicy{action: unconsumedActionDrain}
+	// FailUnconsumed fails with ErrHookDidNotConsume if any data is left.
+	FailUnconsumed = UnconsumedPolicy{action: unconsumedActionFail}
+)
+
+// DrainUnconsumedUpTo discards the rest of the part up to limit.
+// If more data is left, it fails with ErrHookDidNotConsume.
+func DrainUnconsumedUpTo(limit DataSize) UnconsumedPolicy {
+	return UnconsumedPolicy{
+		action: unconsumedActionDrainLimit,
+		limit:  limit,
+	}
+}
+
+// Stats is the statistics of the parsing.
+type Stats struct {
+	// DrainedParts is the number of parts left unread by the hooks and discarded by the parser.
+	DrainedParts uint
+	// DrainedBytes is the total size of the data discarded from DrainedParts.
+	DrainedBytes int64
+	// UnconsumedErrors is the number of parts failed with ErrHookDidNotConsume.
+	UnconsumedErrors uint
+	// SkippedParts is the number of parts skipped by HeaderCheckFunc.
+	SkippedParts uint
+}
+
+// Stats returns the statistics of the parsing.
+func (p *Parser) Stats() Stats {
+	return p.stats
+}
+
+// consumeRest handles the rest of the part after the hook succeeded, according to the UnconsumedPolicy.
+func (jh judgeHook) consumeRest(r io.Reader) error {
+	var (
+		rest int64
+		err  error
+	)
+	if content, ok := r.(bufferedContent); ok {
+		rest, err = bufferedRest(content)
+	} else {
+		rest, err = jh.drain(r)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case rest == 0:
+		return nil
+	case jh.unconsumed.action == unconsumedActionFail,
+		jh.unconsumed.action == unconsumedActionDrainLimit && DataSize(rest) > jh.unconsumed.limit:
+		jh.stats.UnconsumedErrors++
+		return ErrHookDidNotConsume
+	}
+
+	jh.stats.DrainedParts++
+	jh.stats.DrainedBytes += rest
+
+	return nil
+}
+
+// bufferedRest returns the size of the unread data.
+// The data is already buffered, so it does not need to be read.
+func bufferedRest(content bufferedContent) (int64, error) {
+	offset, err := content.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get offset: %w", err)
+	}
+
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size: %w", err)
+	}
+
+	return max(size-offset, 0), nil
+}
+
+// drain reads the rest of the part from the stream.
+// It reads only as much as needed to decide according to the UnconsumedPolicy.
+func (jh judgeHook) drain(r io.Reader) (int64, error) {
+	var (
+		n   int64
+		err error
+	)
+	switch jh.unconsumed.action {
+	case unconsumedActionFail:
+		n, err = io.CopyN(io.Discard, r, 1)
+	case unconsumedActionDrainLimit:
+		n, err = io.CopyN(io.Discard, r, int64(jh.unconsumed.limit)+1)
+	case unconsumedActionDrain:
+		n, err = io.Copy(io.Discard, r)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, fmt.Errorf("failed to drain: %w", err)
+	}
+
+	return n, nil
+}
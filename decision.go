@@ -0,0 +1,79 @@
+package formstream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+)
+
+// ErrPartRejected is returned when a part is rejected by HeaderCheckFunc.
+var ErrPartRejected = errors.New("part rejected")
+
+type decisionAction int
+
+const (
+	decisionActionAccept decisionAction = iota
+	decisionActionSkip
+	decisionActionReject
+)
+
+// Decision is the result of HeaderCheckFunc.
+type Decision struct {
+	action decisionAction
+	err    error
+}
+
+var (
+	// Accept passes the part to the stream hook.
+	Accept = Decision{action: decisionActionAccept}
+	// Skip discards the part without running the stream hook.
+	// The skipped part is not treated as arrived for WithRequiredPart.
+	Skip = Decision{action: decisionActionSkip}
+)
+
+// Reject stops the parsing with err.
+// The error returned by Parse wraps both ErrPartRejected and err.
+func Reject(err error) Decision {
+	return Decision{
+		action: decisionActionReject,
+		err:    err,
+	}
+}
+
+// HeaderCheckFunc decides whether to read a part only from its header.
+type HeaderCheckFunc = func(header Header) Decision
+
+// WithHeaderCheck sets the function to check the header of the part before its body is read.
+// It is called before the part is passed to the stream hook or buffered on memory or disk,
+// and before the part is decoded with WithDecompression, so the header still has its Content-Encoding.
+func WithHeaderCheck(fn HeaderCheckFunc) RegisterOption {
+	return func(c *registerConfig) {
+		c.headerCheck = fn
+	}
+}
+
+// checkHeader runs HeaderCheckFunc of the hook and reports whether the part should be passed to the hook.
+func (p *Parser) checkHeader(part *multipart.Part, header Header) (bool, error) {
+	hook, ok := p.hookMap[part.FormName()]
+	if !ok || hook.headerCheck == nil {
+		return true, nil
+	}
+
+	decision := hook.headerCheck(header)
+	switch decision.action {
+	case decisionActionSkip:
+		_, err := io.Copy(io.Discard, part)
+		if err != nil {
+			return false, fmt.Errorf("failed to skip part: %w", err)
+		}
+		p.stats.SkippedParts++
+
+		return false, nil
+	case decisionActionReject:
+		return false, fmt.Errorf("%w(%s): %w", ErrPartRejected, part.FormName(), decision.err)
+	case decisionActionAccept:
+	}
+
+	return true, nil
+}
@@ -0,0 +1,134 @@
+package formstream
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+)
+
+// ErrUnsupportedEncoding is returned when the body or a part has a Content-Encoding without a decoder.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// DecoderFunc returns the reader decoding r.
+type DecoderFunc func(r io.Reader) (io.ReadCloser, error)
+
+var defaultDecoders = map[string]DecoderFunc{
+	"gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"x-gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"deflate": zlib.NewReader,
+}
+
+// WithDecompression decodes the body and the parts compressed with Content-Encoding gzip or deflate,
+// before the hooks and Value see them.
+// The body is decoded according to WithContentEncoding, and each part according to its Content-Encoding header,
+// which is removed from the Header after decoding.
+// The memory limits count the decoded bytes.
+// Other encodings can be added with WithDecoder.
+func WithDecompression() ParserOption {
+	return func(c *parserConfig) {
+		if c.decoders == nil {
+			c.decoders = maps.Clone(defaultDecoders)
+		}
+	}
+}
+
+// WithDecoder adds the decoder for encoding (e.g. "zstd") and enables WithDecompression.
+func WithDecoder(encoding string, fn DecoderFunc) ParserOption {
+	return func(c *parserConfig) {
+		WithDecompression()(c)
+		c.decoders[strings.ToLower(encoding)] = fn
+	}
+}
+
+// WithContentEncoding sets the Content-Encoding of the body.
+// The encodings in a comma-separated list are decoded in reverse order.
+// Encodings other than "identity" require WithDecompression; otherwise Parse fails with ErrUnsupportedEncoding.
+func WithContentEncoding(encoding string) ParserOption {
+	return func(c *parserConfig) {
+		c.contentEncoding = encoding
+	}
+}
+
+// WithMaxDecompressedSize sets the maximum decoded size of the body and of each part.
+// If it is exceeded, Parse fails with ErrTooLargeForm.
+// default: no limit
+func WithMaxDecompressedSize(maxDecompressedSize DataSize) ParserOption {
+	return func(c *parserConfig) {
+		c.maxDecompressedSize = maxDecompressedSize
+	}
+}
+
+// decode returns the reader decoding r according to encoding.
+// The returned closer must be called after reading.
+func (c *parserConfig) decode(r io.Reader, encoding string) (io.Reader, func() error, error) {
+	var closers []io.Closer
+	closeFunc := func() error {
+		var errs []error
+		for _, closer := range closers {
+			errs = append(errs, closer.Close())
+		}
+
+		return errors.Join(errs...)
+	}
+
+	encodings := strings.Split(encoding, ",")
+	decoded := false
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if encoding == "" || encoding == "identity" {
+			continue
+		}
+
+		fn, ok := c.decoders[encoding]
+		if !ok {
+			return nil, nil, errors.Join(fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding), closeFunc())
+		}
+
+		rc, err := fn(r)
+		if err != nil {
+			return nil, nil, errors.Join(fmt.Errorf("failed to create %s decoder: %w", encoding, err), closeFunc())
+		}
+		closers = append(closers, rc)
+		r = rc
+		decoded = true
+	}
+
+	if decoded && c.maxDecompressedSize > 0 {
+		r = &decodedLimitReader{r: r, remaining: int64(c.maxDecompressedSize)}
+	}
+
+	return r, closeFunc, nil
+}
+
+// decodedLimitReader fails with ErrTooLargeForm when more than remaining bytes are decoded.
+type decodedLimitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (lr *decodedLimitReader) Read(p []byte) (int, error) {
+	if lr.remaining < 0 {
+		return 0, ErrTooLargeForm
+	}
+
+	// read one more byte to detect the limit violation
+	if int64(len(p)) > lr.remaining+1 {
+		p = p[:lr.remaining+1]
+	}
+
+	n, err := lr.r.Read(p)
+	lr.remaining -= int64(n)
+	if lr.remaining < 0 {
+		return n + int(lr.remaining), ErrTooLargeForm
+	}
+
+	return n, err
+}
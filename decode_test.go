@@ -0,0 +1,316 @@
+package formstream_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/mazrean/formstream"
+)
+
+func compress(t *testing.T, encoding string, data string) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(buf)
+	case "deflate":
+		w = zlib.NewWriter(buf)
+	default:
+		return []byte(data)
+	}
+
+	_, err := w.Write([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestWithDecompression(t *testing.T) {
+	t.Parallel()
+
+	content := strings.Repeat("a", 1000)
+
+	tests := map[string]struct {
+		partEncoding string
+		bodyEncoding string
+		options      []formstream.ParserOption
+		expected     string
+		err          error
+	}{
+		"gzip part": {
+			partEncoding: "gzip",
+			options:      []formstream.ParserOption{formstream.WithDecompression()},
+			expected:     content,
+		},
+		"deflate part": {
+			partEncoding: "deflate",
+			options:      []formstream.ParserOption{formstream.WithDecompression()},
+			expected:     content,
+		},
+		"identity part": {
+			partEncoding: "identity",
+			options:      []formstream.ParserOption{formstream.WithDecompression()},
+			expected:     content,
+		},
+		"disabled": {
+			partEncoding: "gzip",
+			expected:     string(compress(t, "gzip", content)),
+		},
+		"unsupported part": {
+			partEncoding: "br",
+			options:      []formstream.ParserOption{formstream.WithDecompression()},
+			err:          formstream.ErrUnsupportedEncoding,
+		},
+		"custom decoder": {
+			partEncoding: "x-test",
+			options: []formstream.ParserOption{formstream.WithDecoder("x-test", func(r io.Reader) (io.ReadCloser, error) {
+				return io.NopCloser(r), nil
+			})},
+			expected: content,
+		},
+		"gzip body": {
+			bodyEncoding: "gzip",
+			options:      []formstream.ParserOption{formstream.WithDecompression()},
+			expected:     content,
+		},
+		"gzip body and part": {
+			partEncoding: "gzip",
+			bodyEncoding: "gzip",
+			options:      []formstream.ParserOption{formstream.WithDecompression()},
+			expected:     content,
+		},
+		"gzip body(disabled)": {
+			bodyEncoding: "gzip",
+			err:          formstream.ErrUnsupportedEncoding,
+		},
+		"too large part": {
+			partEncoding: "gzip",
+			options: []formstream.ParserOption{
+				formstream.WithDecompression(),
+				formstream.WithMaxDecompressedSize(999),
+			},
+			err: formstream.ErrTooLargeForm,
+		},
+		"too large body": {
+			bodyEncoding: "gzip",
+			options: []formstream.ParserOption{
+				formstream.WithDecompression(),
+				formstream.WithMaxDecompressedSize(1000),
+			},
+			err: formstream.ErrTooLargeForm,
+		},
+		"memory limit counts decoded bytes": {
+			partEncoding: "gzip",
+			options: []formstream.ParserOption{
+				formstream.WithDecompression(),
+				formstream.WithMaxMemSize(500),
+			},
+			err: formstream.ErrTooLargeForm,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+			mw := multipart.NewWriter(buf)
+			err := mw.SetBoundary(boundary)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Disposition", `form-data; name="field"`)
+			if tt.partEncoding != "" {
+				header.Set("Content-Encoding", tt.partEncoding)
+			}
+			w, err := mw.CreatePart(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = w.Write(compress(t, tt.partEncoding, content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body := compress(t, tt.bodyEncoding, buf.String())
+
+			options := tt.options
+			if tt.bodyEncoding != "" {
+				options = append(options, formstream.WithContentEncoding(tt.bodyEncoding))
+			}
+			parser := formstream.NewParser(boundary, options...)
+
+			err = parser.Parse(bytes.NewReader(body))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+
+			value, valueHeader, ok := parser.Value("field")
+			if !ok {
+				t.Fatal("value not found")
+			}
+			if value != tt.expected {
+				t.Errorf("unexpected value: %d bytes", len(value))
+			}
+
+			expectedEncoding := tt.partEncoding
+			if tt.options != nil {
+				expectedEncoding = ""
+			}
+			if encoding := valueHeader.Get("Content-Encoding"); encoding != expectedEncoding {
+				t.Errorf("unexpected Content-Encoding: %s", encoding)
+			}
+		})
+	}
+}
+
+func TestWithDecompression_hook(t *testing.T) {
+	t.Parallel()
+
+	content := strings.Repeat("a", 1000)
+
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	err := mw.SetBoundary(boundary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="stream"; filename="test.txt"`)
+	header.Set("Content-Encoding", "gzip")
+	w, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write(compress(t, "gzip", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mw.WriteField("field", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, requirement := range []string{"", "field"} {
+		parser := formstream.NewParser(boundary, formstream.WithDecompression(), formstream.WithMaxMemFileSize(10))
+
+		var options []formstream.RegisterOption
+		if requirement != "" {
+			options = append(options, formstream.WithRequiredPart(requirement))
+		}
+
+		var actual string
+		err = parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+			data, err := io.ReadAll(r)
+			actual = string(data)
+			return err
+		}, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = parser.Parse(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if actual != content {
+			t.Errorf("unexpected content: %d bytes", len(actual))
+		}
+	}
+}
+
+func TestWithDecompression_headerCheck(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	err := mw.SetBoundary(boundary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="stream"; filename="test.txt"`)
+	header.Set("Content-Encoding", "gzip")
+	w, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// not gzip
+	_, err = w.Write([]byte("invalid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		decision formstream.Decision
+		err      error
+	}{
+		"skip": {
+			decision: formstream.Skip,
+		},
+		"reject": {
+			decision: formstream.Reject(errTest),
+			err:      formstream.ErrPartRejected,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			parser := formstream.NewParser(boundary, formstream.WithDecompression())
+
+			err := parser.Register("stream", func(io.Reader, formstream.Header) error {
+				t.Error("hook must not run")
+				return nil
+			}, formstream.WithHeaderCheck(func(header formstream.Header) formstream.Decision {
+				if header.Get("Content-Encoding") != "gzip" {
+					t.Errorf("unexpected Content-Encoding: %s", header.Get("Content-Encoding"))
+				}
+
+				return tt.decision
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(bytes.NewReader(buf.Bytes()))
+			if !errors.Is(err, tt.err) || errors.Is(err, formstream.ErrMalformed) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
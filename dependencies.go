@@ -0,0 +1,69 @@
+package formstream
+
+import "slices"
+
+// Dependencies is a read-only view of the parts and the results required by a stream hook.
+// Only the parts and the results registered with the RegisterOptions are visible.
+type Dependencies struct {
+	valueMap  map[string][]Value
+	names     []string
+	resultMap map[string][]any
+	results   []string
+}
+
+// Names returns the names of the required parts.
+func (d Dependencies) Names() []string {
+	return slices.Clone(d.names)
+}
+
+// Value first value of the required part.
+func (d Dependencies) Value(key string) (string, Header, bool) {
+	value, ok := d.Values(key)
+	if !ok || len(value) == 0 {
+		return "", Header{}, false
+	}
+
+	content, header := value[0].Unwrap()
+
+	return content, header, true
+}
+
+// ValueRaw first value of the required part.
+func (d Dependencies) ValueRaw(key string) ([]byte, Header, bool) {
+	value, ok := d.Values(key)
+	if !ok || len(value) == 0 {
+		return nil, Header{}, false
+	}
+
+	content, header := value[0].UnwrapRaw()
+
+	return content, header, true
+}
+
+// Values all values of the required part.
+func (d Dependencies) Values(key string) ([]Value, bool) {
+	if !slices.Contains(d.names, key) {
+		return nil, false
+	}
+
+	value, ok := d.valueMap[key]
+	if !ok {
+		return nil, false
+	}
+
+	return slices.Clone(value), true
+}
+
+// Result first result of the required stream hook.
+func (d Dependencies) Result(name string) (any, bool) {
+	if !slices.Contains(d.results, name) {
+		return nil, false
+	}
+
+	results := d.resultMap[name]
+	if len(results) == 0 {
+		return nil, false
+	}
+
+	return results[0], true
+}
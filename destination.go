@@ -0,0 +1,202 @@
+package formstream
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Destination is the storage the save hooks write to.
+// Names are relative to the destination.
+// If the Destination also implements Sync() error, it is called after renaming with WithSync,
+// to flush the directory entries.
+type Destination interface {
+	// CreateTemp creates a new file with a unique name, as os.CreateTemp does with pattern.
+	CreateTemp(pattern string) (DestinationFile, error)
+	// Rename renames oldName to newName atomically.
+	// If replace is false and newName exists, it fails with an error wrapping fs.ErrExist.
+	Rename(oldName, newName string, replace bool) error
+	// Remove removes the file.
+	Remove(name string) error
+}
+
+// DestinationFile is a file created by Destination.CreateTemp.
+type DestinationFile interface {
+	io.WriteCloser
+	// Name returns the name of the file in the destination.
+	Name() string
+	// Sync flushes the file to the storage.
+	Sync() error
+}
+
+// fileMover is implemented by the destinations that can take a local file without copying it.
+type fileMover interface {
+	moveFile(f *os.File, name string, replace bool) error
+}
+
+// DirDestination returns the Destination writing to the directory dir.
+func DirDestination(dir string) Destination {
+	return dirDestination(dir)
+}
+
+type dirDestination string
+
+type dirFile struct {
+	*os.File
+	name string
+}
+
+func (f dirFile) Name() string {
+	return f.name
+}
+
+func (d dirDestination) CreateTemp(pattern string) (DestinationFile, error) {
+	f, err := os.CreateTemp(string(d), pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return dirFile{File: f, name: filepath.Base(f.Name())}, nil
+}
+
+func (d dirDestination) Rename(oldName, newName string, replace bool) error {
+	return d.rename(filepath.Join(string(d), oldName), newName, replace)
+}
+
+func (d dirDestination) rename(oldPath, newName string, replace bool) error {
+	newPath := filepath.Join(string(d), newName)
+	if replace {
+		return os.Rename(oldPath, newPath)
+	}
+
+	// link fails if newPath exists, unlike rename
+	err := os.Link(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(oldPath)
+}
+
+func (d dirDestination) Remove(name string) error {
+	return os.Remove(filepath.Join(string(d), name))
+}
+
+func (d dirDestination) Sync() error {
+	return syncDir(string(d))
+}
+
+func (d dirDestination) moveFile(f *os.File, name string, replace bool) error {
+	return d.rename(f.Name(), name, replace)
+}
+
+// syncDir flushes the directory entries.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = f.Sync()
+	if err != nil && !errors.Is(err, fs.ErrInvalid) {
+		return err
+	}
+
+	return nil
+}
+
+// RootDestination returns the Destination writing to root.
+// The files can not escape root, even through symbolic links.
+func RootDestination(root *os.Root) Destination {
+	return rootDestination{root: root}
+}
+
+type rootDestination struct {
+	root *os.Root
+}
+
+type rootFile struct {
+	*os.File
+	name string
+}
+
+func (f rootFile) Name() string {
+	return f.name
+}
+
+func (d rootDestination) CreateTemp(pattern string) (DestinationFile, error) {
+	for range 10000 {
+		name, err := tempName(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := d.root.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return rootFile{File: f, name: name}, nil
+	}
+
+	return nil, &fs.PathError{Op: "createtemp", Path: pattern, Err: fs.ErrExist}
+}
+
+// tempName replaces the last "*" in pattern with a random string, as os.CreateTemp does.
+func tempName(pattern string) (string, error) {
+	var b [8]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to generate random name: %w", err)
+	}
+	random := fmt.Sprintf("%x", b)
+
+	for i := len(pattern) - 1; i >= 0; i-- {
+		if pattern[i] == '*' {
+			return pattern[:i] + random + pattern[i+1:], nil
+		}
+	}
+
+	return pattern + random, nil
+}
+
+func (d rootDestination) Rename(oldName, newName string, replace bool) error {
+	if replace {
+		return d.root.Rename(oldName, newName)
+	}
+
+	// link fails if newName exists, unlike rename
+	err := d.root.Link(oldName, newName)
+	if err != nil {
+		return err
+	}
+
+	return d.root.Remove(oldName)
+}
+
+func (d rootDestination) Remove(name string) error {
+	return d.root.Remove(name)
+}
+
+func (d rootDestination) Sync() error {
+	f, err := d.root.Open(".")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = f.Sync()
+	if err != nil && !errors.Is(err, fs.ErrInvalid) {
+		return err
+	}
+
+	return nil
+}
@@ -1,10 +1,12 @@
 package echoform
 
 import (
+	"context"
 	"errors"
 	"io"
 	"mime"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/mazrean/formstream"
@@ -13,6 +15,9 @@ import (
 type Parser struct {
 	*formstream.Parser
 	reader io.Reader
+	writer http.ResponseWriter
+	// ctx the context of the request, which cancels the parsing when the request is canceled
+	ctx context.Context
 }
 
 func NewParser(c echo.Context, options ...formstream.ParserOption) (*Parser, error) {
@@ -27,21 +32,52 @@ func NewParser(c echo.Context, options ...formstream.ParserOption) (*Parser, err
 		return nil, http.ErrMissingBoundary
 	}
 
+	if encoding := c.Request().Header.Get("Content-Encoding"); encoding != "" {
+		// the options given by the caller take precedence
+		options = append([]formstream.ParserOption{formstream.WithContentEncoding(encoding)}, options...)
+	}
+	if c.Request().ContentLength >= 0 {
+		options = append([]formstream.ParserOption{formstream.WithContentLength(c.Request().ContentLength)}, options...)
+	}
+
 	return &Parser{
 		Parser: formstream.NewParser(boundary, options...),
 		reader: c.Request().Body,
+		writer: c.Response(),
+		ctx:    c.Request().Context(),
 	}, nil
 }
 
 // Parse parses the request body.
-// It returns the echo.HTTPError if the hook function returns an echo.HTTPError.
+// It returns the echo.HTTPError if the hook function returns an echo.HTTPError or a formstream.StatusError.
+// For formstream.ErrClientTooSlow, it unblocks the read of the body left running in background,
+// which would keep the response from being sent.
 func (p *Parser) Parse() error {
-	err := p.Parser.Parse(p.reader)
+	err := p.Parser.ParseContext(p.ctx, p.reader)
+	if errors.Is(err, formstream.ErrClientTooSlow) {
+		_ = http.NewResponseController(p.writer).SetReadDeadline(time.Now())
+	}
 
 	var httpErr *echo.HTTPError
 	if errors.As(err, &httpErr) {
 		return httpErr
 	}
 
+	var statusErr formstream.StatusError
+	if errors.As(err, &statusErr) {
+		return HTTPError(err)
+	}
+
 	return err
 }
+
+// HTTPError returns the echo.HTTPError with the status code and the message for the error of parsing.
+// See formstream.StatusCode for the status codes.
+func HTTPError(err error) *echo.HTTPError {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+
+	return echo.NewHTTPError(formstream.StatusCode(err), formstream.StatusMessage(err)).SetInternal(err)
+}
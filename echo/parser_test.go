@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/mazrean/formstream"
@@ -99,3 +100,81 @@ func saveUser(_ context.Context, name string, password string, iconReader io.Rea
 
 	return nil
 }
+
+func TestHTTPError(t *testing.T) {
+	t.Parallel()
+
+	err := fmt.Errorf("failed to parse: %w", formstream.ErrMalformed)
+	httpErr := echoform.HTTPError(err)
+	if httpErr.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status code: %d", httpErr.Code)
+	}
+	if httpErr.Message != "Bad Request" {
+		t.Errorf("unexpected message: %v", httpErr.Message)
+	}
+	if httpErr.Internal != err {
+		t.Errorf("unexpected internal error: %v", httpErr.Internal)
+	}
+
+	orig := echo.NewHTTPError(http.StatusForbidden)
+	if echoform.HTTPError(fmt.Errorf("hook: %w", orig)) != orig {
+		t.Errorf("echo.HTTPError is not kept")
+	}
+}
+
+func TestParse_slowClient(t *testing.T) {
+	t.Parallel()
+
+	e := echo.New()
+	e.POST("/", func(c echo.Context) error {
+		parser, err := echoform.NewParser(c, formstream.WithIdleTimeout(50*time.Millisecond))
+		if err != nil {
+			return err
+		}
+
+		err = parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		err = parser.Parse()
+		if err != nil {
+			return echoform.HTTPError(err)
+		}
+
+		return c.NoContent(http.StatusOK)
+	})
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	// the client stalls after the first bytes of the body
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		_, _ = pw.Write([]byte("--boundary\r\n" +
+			"Content-Disposition: form-data; name=\"stream\"\r\n\r\n" +
+			"aaa"))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(echo.HeaderContentType, "multipart/form-data; boundary=boundary")
+
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to receive the response: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+}
@@ -4,12 +4,17 @@ import (
 	"io"
 	"mime"
 	"net/textproto"
+	"time"
 )
 
 type Parser struct {
-	boundary string
-	valueMap map[string][]Value
-	hookMap  map[string]streamHook
+	boundary  string
+	valueMap  map[string][]Value
+	resultMap map[string][]any
+	hookMap   map[string]streamHook
+	stats     Stats
+	// progress reports the progress of the running Parse. nil without WithProgress.
+	progress *progressReader
 	parserConfig
 }
 
@@ -19,6 +24,7 @@ func NewParser(boundary string, options ...ParserOption) *Parser {
 		maxHeaders:     defaultMaxHeaders,
 		maxMemSize:     defaultMaxMemSize,
 		maxMemFileSize: defaultMaxMemFileSize,
+		contentLength:  -1,
 	}
 	for _, opt := range options {
 		opt(&c)
@@ -27,16 +33,37 @@ func NewParser(boundary string, options ...ParserOption) *Parser {
 	return &Parser{
 		boundary:     boundary,
 		valueMap:     make(map[string][]Value),
+		resultMap:    make(map[string][]any),
 		hookMap:      make(map[string]streamHook),
 		parserConfig: c,
 	}
 }
 
 type parserConfig struct {
-	maxParts       uint
-	maxHeaders     uint
-	maxMemSize     DataSize
-	maxMemFileSize DataSize
+	maxParts         uint
+	maxHeaders       uint
+	maxMemSize       DataSize
+	maxMemFileSize   DataSize
+	unconsumedPolicy UnconsumedPolicy
+	strictOrder      bool
+	budget           *Budget
+	tempDir          string
+	spillFilePerPart bool
+	unlinkTempFiles  bool
+	// decoders the decoders by content encoding. nil means the decompression is disabled.
+	decoders            map[string]DecoderFunc
+	contentEncoding     string
+	maxDecompressedSize DataSize
+	progressFunc        ProgressFunc
+	progressInterval    time.Duration
+	// contentLength the size of the body. -1 if unknown.
+	contentLength int64
+	rateLimit     *rateLimitConfig
+	rateLimiter   *RateLimiter
+	idleTimeout   time.Duration
+	minThroughput int
+	// throughputGracePeriod the time waiting for the client before checking minThroughput
+	throughputGracePeriod time.Duration
 }
 
 type ParserOption func(*parserConfig)
@@ -89,6 +116,23 @@ func WithMaxMemFileSize(maxMemFileSize DataSize) ParserOption {
 	}
 }
 
+// WithStrictOrder makes the parser fail with ErrOutOfOrder when a part for a stream hook arrives before its required parts,
+// instead of buffering the part on memory or disk.
+// It is useful when the clients are expected to send the required parts first.
+func WithStrictOrder() ParserOption {
+	return func(c *parserConfig) {
+		c.strictOrder = true
+	}
+}
+
+// WithUnconsumedPolicy sets how to handle the rest of a part when a stream hook returns without reading it to the end.
+// default: DrainUnconsumed
+func WithUnconsumedPolicy(policy UnconsumedPolicy) ParserOption {
+	return func(c *parserConfig) {
+		c.unconsumedPolicy = policy
+	}
+}
+
 type Value struct {
 	content []byte
 	header  Header
@@ -109,6 +153,12 @@ type Header struct {
 	header            textproto.MIMEHeader
 }
 
+// NewHeader returns the Header of a part with the MIME header h.
+// It lets stream hooks process data not coming from a multipart form, e.g. uploads with other protocols.
+func NewHeader(h textproto.MIMEHeader) Header {
+	return newHeader(h)
+}
+
 func newHeader(h textproto.MIMEHeader) Header {
 	contentDisposition := h.Get("Content-Disposition")
 	_, params, err := mime.ParseMediaType(contentDisposition)
@@ -148,7 +198,20 @@ func (h Header) FileName() string {
 
 type StreamHookFunc = func(r io.Reader, header Header) error
 
+// StreamHookWithDependenciesFunc is a StreamHookFunc that also receives the values of its required parts.
+type StreamHookWithDependenciesFunc = func(r io.Reader, header Header, deps Dependencies) error
+
+// StreamHookWithResultFunc is a StreamHookWithDependenciesFunc that publishes a result to the hooks depending on it.
+type StreamHookWithResultFunc = func(r io.Reader, header Header, deps Dependencies) (any, error)
+
 type streamHook struct {
-	fn           StreamHookFunc
+	fn           StreamHookWithResultFunc
+	hasResult    bool
 	requireParts []string
+	retry        retryConfig
+	spool        spoolConfig
+	headerCheck  HeaderCheckFunc
+	requirements []Requirement
+	forceSpool   bool
+	rateLimit    *rateLimitConfig
 }
@@ -2,6 +2,7 @@ package formstream_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mazrean/formstream"
 	"github.com/mazrean/formstream/internal/myio"
@@ -69,8 +71,706 @@ large file contents
 	// value
 }
 
+func TestRegisterWithDependencies(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		form string
+	}{
+		"fast path": {
+			form: "--boundary\r\n" +
+				"Content-Disposition: form-data; name=\"name\"\r\n" +
+				"\r\n" +
+				"mazrean\r\n" +
+				"--boundary\r\n" +
+				"Content-Disposition: form-data; name=\"password\"\r\n" +
+				"\r\n" +
+				"password\r\n" +
+				"--boundary\r\n" +
+				"Content-Disposition: form-data; name=\"icon\"; filename=\"icon.png\"\r\n" +
+				"\r\n" +
+				"icon contents\r\n" +
+				"--boundary--\r\n",
+		},
+		"slow path": {
+			form: "--boundary\r\n" +
+				"Content-Disposition: form-data; name=\"icon\"; filename=\"icon.png\"\r\n" +
+				"\r\n" +
+				"icon contents\r\n" +
+				"--boundary\r\n" +
+				"Content-Disposition: form-data; name=\"name\"\r\n" +
+				"\r\n" +
+				"mazrean\r\n" +
+				"--boundary\r\n" +
+				"Content-Disposition: form-data; name=\"password\"\r\n" +
+				"\r\n" +
+				"password\r\n" +
+				"--boundary--\r\n",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			parser := formstream.NewParser(boundary)
+
+			called := false
+			err := parser.RegisterWithDependencies("icon", func(r io.Reader, _ formstream.Header, deps formstream.Dependencies) error {
+				called = true
+
+				name, _, ok := deps.Value("name")
+				if !ok || name != "mazrean" {
+					t.Errorf("unexpected name: %s, %t", name, ok)
+				}
+
+				password, _, ok := deps.Value("password")
+				if !ok || password != "password" {
+					t.Errorf("unexpected password: %s, %t", password, ok)
+				}
+
+				_, _, ok = deps.Value("icon")
+				if ok {
+					t.Error("unexpected access to not required part")
+				}
+
+				_, err := io.Copy(io.Discard, r)
+				return err
+			}, formstream.WithRequiredPart("name"), formstream.WithRequiredPart("password"))
+			if err != nil {
+				t.Fatalf("failed to register: %s", err)
+			}
+
+			err = parser.Parse(strings.NewReader(tt.form))
+			if err != nil {
+				t.Fatalf("failed to parse: %s", err)
+			}
+
+			if !called {
+				t.Error("hook is not called")
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		reverse    bool
+		spool      formstream.DataSize
+		failCount  int
+		maxRetries uint
+		calls      int
+		isErr      bool
+		spoolErr   bool
+	}{
+		"retry succeeded": {
+			reverse:    true,
+			failCount:  2,
+			maxRetries: 2,
+			calls:      3,
+		},
+		"retry exhausted": {
+			reverse:    true,
+			failCount:  3,
+			maxRetries: 2,
+			calls:      3,
+			isErr:      true,
+		},
+		"no retry on stream": {
+			reverse:    false,
+			failCount:  1,
+			maxRetries: 2,
+			calls:      1,
+			isErr:      true,
+		},
+		"retry on stream with spooling": {
+			reverse:    false,
+			spool:      2 * formstream.MB,
+			failCount:  2,
+			maxRetries: 2,
+			calls:      3,
+		},
+		"too large to spool": {
+			reverse:    false,
+			spool:      10 * formstream.KB,
+			failCount:  1,
+			maxRetries: 2,
+			calls:      1,
+			isErr:      true,
+			spoolErr:   true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := sampleForm(1*formstream.MB, boundary, tt.reverse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			parser := formstream.NewParser(boundary, formstream.WithMaxMemFileSize(1*formstream.KB))
+
+			options := []formstream.RegisterOption{
+				formstream.WithRequiredPart("field"),
+				formstream.WithRetry(tt.maxRetries, formstream.ConstantBackoff(0)),
+			}
+			if tt.spool != 0 {
+				options = append(options, formstream.WithSpooling(tt.spool))
+			}
+
+			calls := 0
+			err = parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+				calls++
+
+				if tt.reverse || calls > 1 {
+					if _, ok := r.(io.ReadSeeker); !ok {
+						t.Errorf("reader is not io.ReadSeeker: %T", r)
+					}
+					if _, ok := r.(io.ReaderAt); !ok {
+						t.Errorf("reader is not io.ReaderAt: %T", r)
+					}
+				}
+
+				if calls <= tt.failCount {
+					// read partially and fail
+					_, err := io.CopyN(io.Discard, r, 10)
+					if err != nil {
+						return err
+					}
+
+					return errTest
+				}
+
+				n, err := io.Copy(io.Discard, r)
+				if err != nil {
+					return err
+				}
+				if n != int64(formstream.MB) {
+					t.Errorf("unexpected size: %d", n)
+				}
+
+				return nil
+			}, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(r)
+			if tt.isErr != errors.Is(err, errTest) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.spoolErr != errors.Is(err, formstream.ErrSpoolTooLarge) {
+				t.Errorf("unexpected spool error: %v", err)
+			}
+
+			if calls != tt.calls {
+				t.Errorf("unexpected calls: expected %d, actual %d", tt.calls, calls)
+			}
+		})
+	}
+}
+
+func TestWithRetryCanceled(t *testing.T) {
+	t.Parallel()
+
+	r, err := sampleForm(1*formstream.KB, boundary, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	parser := formstream.NewParser(boundary)
+
+	calls := 0
+	err = parser.Register("stream", func(io.Reader, formstream.Header) error {
+		calls++
+		// the request is canceled while the hook is failing
+		cancel()
+
+		return errTest
+	}, formstream.WithRequiredPart("field"), formstream.WithRetry(3, formstream.ConstantBackoff(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- parser.ParseContext(ctx, r)
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) || !errors.Is(err, errTest) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("backoff is not canceled")
+	}
+
+	if calls != 1 {
+		t.Errorf("unexpected calls: %d", calls)
+	}
+}
+
+func TestWithUnconsumedPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		reverse bool
+		policy  formstream.UnconsumedPolicy
+		isErr   bool
+		stats   formstream.Stats
+	}{
+		"drain": {
+			policy: formstream.DrainUnconsumed,
+			stats: formstream.Stats{
+				DrainedParts: 1,
+				DrainedBytes: int64(formstream.MB) - 10,
+			},
+		},
+		"drain(buffered)": {
+			reverse: true,
+			policy:  formstream.DrainUnconsumed,
+			stats: formstream.Stats{
+				DrainedParts: 1,
+				DrainedBytes: int64(formstream.MB) - 10,
+			},
+		},
+		"drain up to": {
+			policy: formstream.DrainUnconsumedUpTo(formstream.MB),
+			stats: formstream.Stats{
+				DrainedParts: 1,
+				DrainedBytes: int64(formstream.MB) - 10,
+			},
+		},
+		"drain up to(exceeded)": {
+			policy: formstream.DrainUnconsumedUpTo(formstream.KB),
+			isErr:  true,
+			stats: formstream.Stats{
+				UnconsumedErrors: 1,
+			},
+		},
+		"drain up to(buffered, exceeded)": {
+			reverse: true,
+			policy:  formstream.DrainUnconsumedUpTo(formstream.KB),
+			isErr:   true,
+			stats: formstream.Stats{
+				UnconsumedErrors: 1,
+			},
+		},
+		"fail": {
+			policy: formstream.FailUnconsumed,
+			isErr:  true,
+			stats: formstream.Stats{
+				UnconsumedErrors: 1,
+			},
+		},
+		"fail(buffered)": {
+			reverse: true,
+			policy:  formstream.FailUnconsumed,
+			isErr:   true,
+			stats: formstream.Stats{
+				UnconsumedErrors: 1,
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := sampleForm(1*formstream.MB, boundary, tt.reverse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			parser := formstream.NewParser(boundary, formstream.WithMaxMemFileSize(1*formstream.KB), formstream.WithUnconsumedPolicy(tt.policy))
+
+			err = parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+				_, err := io.CopyN(io.Discard, r, 10)
+				return err
+			}, formstream.WithRequiredPart("field"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(r)
+			if tt.isErr != errors.Is(err, formstream.ErrHookDidNotConsume) {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if stats := parser.Stats(); stats != tt.stats {
+				t.Errorf("unexpected stats: expected %+v, actual %+v", tt.stats, stats)
+			}
+		})
+	}
+}
+
+func TestWithHeaderCheck(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		reverse  bool
+		decision formstream.Decision
+		called   bool
+		isErr    bool
+		skipped  uint
+	}{
+		"accept": {
+			decision: formstream.Accept,
+			called:   true,
+		},
+		"accept(buffered)": {
+			reverse:  true,
+			decision: formstream.Accept,
+			called:   true,
+		},
+		"skip": {
+			decision: formstream.Skip,
+			skipped:  1,
+		},
+		"skip(buffered)": {
+			reverse:  true,
+			decision: formstream.Skip,
+			skipped:  1,
+		},
+		"reject": {
+			decision: formstream.Reject(errTest),
+			isErr:    true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := sampleForm(1*formstream.MB, boundary, tt.reverse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			parser := formstream.NewParser(boundary)
+
+			called := false
+			err = parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+				called = true
+
+				_, err := io.Copy(io.Discard, r)
+				return err
+			}, formstream.WithRequiredPart("field"), formstream.WithHeaderCheck(func(header formstream.Header) formstream.Decision {
+				if header.FileName() != "file.txt" {
+					t.Errorf("unexpected file name: %s", header.FileName())
+				}
+
+				return tt.decision
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(r)
+			if tt.isErr != errors.Is(err, errTest) || tt.isErr != errors.Is(err, formstream.ErrPartRejected) {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if called != tt.called {
+				t.Errorf("unexpected call: expected %t, actual %t", tt.called, called)
+			}
+
+			if skipped := parser.Stats().SkippedParts; skipped != tt.skipped {
+				t.Errorf("unexpected skipped parts: expected %d, actual %d", tt.skipped, skipped)
+			}
+
+			if !tt.isErr {
+				if value, _, _ := parser.Value("field"); value != "value" {
+					t.Errorf("unexpected value: %s", value)
+				}
+			}
+		})
+	}
+}
+
+func TestWithRequirement(t *testing.T) {
+	t.Parallel()
+
+	isImage := func(value string, _ formstream.Header) bool {
+		return value == "image"
+	}
+
+	tests := map[string]struct {
+		fields  [][2]string
+		options []formstream.RegisterOption
+		called  bool
+	}{
+		"any(first)": {
+			fields:  [][2]string{{"user_id", "1"}, {"stream", "contents"}},
+			options: []formstream.RegisterOption{formstream.WithRequiredAnyPart("user_id", "session_token")},
+			called:  true,
+		},
+		"any(second)": {
+			fields:  [][2]string{{"stream", "contents"}, {"session_token", "token"}},
+			options: []formstream.RegisterOption{formstream.WithRequiredAnyPart("user_id", "session_token")},
+			called:  true,
+		},
+		"any(none)": {
+			fields:  [][2]string{{"stream", "contents"}, {"name", "name"}},
+			options: []formstream.RegisterOption{formstream.WithRequiredAnyPart("user_id", "session_token")},
+			called:  false,
+		},
+		"if(required and arrived)": {
+			fields:  [][2]string{{"kind", "image"}, {"stream", "contents"}, {"thumbnail_meta", "meta"}},
+			options: []formstream.RegisterOption{formstream.WithRequiredPartIf("thumbnail_meta", "kind", isImage)},
+			called:  true,
+		},
+		"if(required and not arrived)": {
+			fields:  [][2]string{{"kind", "image"}, {"stream", "contents"}},
+			options: []formstream.RegisterOption{formstream.WithRequiredPartIf("thumbnail_meta", "kind", isImage)},
+			called:  false,
+		},
+		"if(not required)": {
+			fields:  [][2]string{{"kind", "video"}, {"stream", "contents"}},
+			options: []formstream.RegisterOption{formstream.WithRequiredPartIf("thumbnail_meta", "kind", isImage)},
+			called:  true,
+		},
+		"if(key not arrived)": {
+			fields:  [][2]string{{"stream", "contents"}, {"thumbnail_meta", "meta"}},
+			options: []formstream.RegisterOption{formstream.WithRequiredPartIf("thumbnail_meta", "kind", isImage)},
+			called:  false,
+		},
+		"all of any": {
+			fields: [][2]string{{"stream", "contents"}, {"b", "b"}, {"c", "c"}},
+			options: []formstream.RegisterOption{formstream.WithRequirement(formstream.AllOf(
+				formstream.AnyOf(formstream.Part("a"), formstream.Part("b")),
+				formstream.Part("c"),
+			))},
+			called: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := bytes.NewBuffer(nil)
+			mw := multipart.NewWriter(buf)
+			err := mw.SetBoundary(boundary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range tt.fields {
+				err := mw.WriteField(field[0], field[1])
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = mw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parser := formstream.NewParser(boundary)
+
+			called := false
+			err = parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+				called = true
+
+				_, err := io.Copy(io.Discard, r)
+				return err
+			}, tt.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(buf)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if called != tt.called {
+				t.Errorf("unexpected call: expected %t, actual %t", tt.called, called)
+			}
+		})
+	}
+}
+
+func TestRegisterWithResult(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fields [][2]string
+	}{
+		"upload first": {
+			fields: [][2]string{{"upload", "contents"}, {"thumbnail", "thumbnail"}},
+		},
+		"thumbnail first": {
+			fields: [][2]string{{"thumbnail", "thumbnail"}, {"upload", "contents"}},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := bytes.NewBuffer(nil)
+			mw := multipart.NewWriter(buf)
+			err := mw.SetBoundary(boundary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range tt.fields {
+				err := mw.WriteField(field[0], field[1])
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = mw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parser := formstream.NewParser(boundary)
+
+			err = parser.RegisterWithResult("upload", func(r io.Reader, _ formstream.Header, _ formstream.Dependencies) (any, error) {
+				_, err := io.Copy(io.Discard, r)
+				if err != nil {
+					return nil, err
+				}
+
+				return "uploads/key", nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			called := false
+			err = parser.RegisterWithDependencies("thumbnail", func(r io.Reader, _ formstream.Header, deps formstream.Dependencies) error {
+				called = true
+
+				key, ok := deps.Result("upload")
+				if !ok || key != "uploads/key" {
+					t.Errorf("unexpected result: %v, %t", key, ok)
+				}
+
+				_, err := io.Copy(io.Discard, r)
+				return err
+			}, formstream.WithRequiredResult("upload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(buf)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !called {
+				t.Error("hook is not called")
+			}
+
+			if key, ok := parser.Result("upload"); !ok || key != "uploads/key" {
+				t.Errorf("unexpected result: %v, %t", key, ok)
+			}
+		})
+	}
+}
+
+func TestRegisterDependencyCycle(t *testing.T) {
+	t.Parallel()
+
+	nop := func(io.Reader, formstream.Header) error { return nil }
+
+	parser := formstream.NewParser(boundary)
+
+	err := parser.Register("a", nop, formstream.WithRequiredResult("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = parser.Register("b", nop, formstream.WithRequiredResult("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = parser.Register("c", nop, formstream.WithRequiredResult("a"))
+
+	var cycleErr formstream.DependencyCycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cycleErr.Hooks) != 3 {
+		t.Errorf("unexpected cycle: %v", cycleErr.Hooks)
+	}
+
+	// the hook in the cycle is not registered
+	err = parser.Register("c", nop)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err = parser.Register("d", nop, formstream.WithRequiredResult("d"))
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWithStrictOrder(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		reverse bool
+		err     error
+	}{
+		"in order": {
+			reverse: false,
+		},
+		"out of order": {
+			reverse: true,
+			err:     formstream.ErrOutOfOrder,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := sampleForm(1*formstream.MB, boundary, tt.reverse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			parser := formstream.NewParser(boundary, formstream.WithStrictOrder())
+
+			err = parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+				_, err := io.Copy(io.Discard, r)
+				return err
+			}, formstream.WithRequiredPart("field"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(r)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
 const boundary = "boundary"
 
+var errTest = errors.New("test error")
+
 func sampleForm(fileSize formstream.DataSize, boundary string, reverse bool) (io.ReadSeekCloser, error) {
 	if fileSize > 1*formstream.GB {
 		f, err := os.CreateTemp("", "formstream-test-form-")
@@ -1,9 +1,12 @@
 package ginform
 
 import (
+	"context"
+	"errors"
 	"io"
 	"mime"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mazrean/formstream"
@@ -12,6 +15,9 @@ import (
 type Parser struct {
 	*formstream.Parser
 	reader io.Reader
+	writer http.ResponseWriter
+	// ctx the context of the request, which cancels the parsing when the request is canceled
+	ctx context.Context
 }
 
 func NewParser(c *gin.Context, options ...formstream.ParserOption) (*Parser, error) {
@@ -26,13 +32,39 @@ func NewParser(c *gin.Context, options ...formstream.ParserOption) (*Parser, err
 		return nil, http.ErrMissingBoundary
 	}
 
+	if encoding := c.GetHeader("Content-Encoding"); encoding != "" {
+		// the options given by the caller take precedence
+		options = append([]formstream.ParserOption{formstream.WithContentEncoding(encoding)}, options...)
+	}
+	if c.Request.ContentLength >= 0 {
+		options = append([]formstream.ParserOption{formstream.WithContentLength(c.Request.ContentLength)}, options...)
+	}
+
 	return &Parser{
 		Parser: formstream.NewParser(boundary, options...),
 		reader: c.Request.Body,
+		writer: c.Writer,
+		ctx:    c.Request.Context(),
 	}, nil
 }
 
 // Parse parses the request body.
+// For formstream.ErrClientTooSlow, it unblocks the read of the body left running in background,
+// which would keep the response from being sent.
 func (p *Parser) Parse() error {
-	return p.Parser.Parse(p.reader)
+	err := p.Parser.ParseContext(p.ctx, p.reader)
+	if errors.Is(err, formstream.ErrClientTooSlow) {
+		_ = http.NewResponseController(p.writer).SetReadDeadline(time.Now())
+	}
+
+	return err
+}
+
+// AbortWithError aborts the request with the status code and the message for the error of parsing,
+// and records err in the context.
+// See formstream.StatusCode for the status codes.
+func AbortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.String(formstream.StatusCode(err), formstream.StatusMessage(err))
+	c.Abort()
 }
@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mazrean/formstream"
@@ -108,3 +109,78 @@ func saveUser(_ context.Context, name string, password string, iconReader io.Rea
 
 	return nil
 }
+
+func TestAbortWithError(t *testing.T) {
+	t.Parallel()
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	ginform.AbortWithError(c, formstream.StatusError{Status: http.StatusConflict, Err: fmt.Errorf("user already exists")})
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("unexpected status code: %d", rec.Code)
+	}
+	if body := rec.Body.String(); body != "user already exists" {
+		t.Errorf("unexpected body: %s", body)
+	}
+	if !c.IsAborted() || len(c.Errors) != 1 {
+		t.Errorf("context is not aborted with the error")
+	}
+}
+
+func TestParse_slowClient(t *testing.T) {
+	t.Parallel()
+
+	router := gin.New()
+	router.POST("/", func(c *gin.Context) {
+		parser, err := ginform.NewParser(c, formstream.WithIdleTimeout(50*time.Millisecond))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		err = parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		err = parser.Parse()
+		if err != nil {
+			ginform.AbortWithError(c, err)
+		}
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// the client stalls after the first bytes of the body
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		_, _ = pw.Write([]byte("--boundary\r\n" +
+			"Content-Disposition: form-data; name=\"stream\"\r\n\r\n" +
+			"aaa"))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to receive the response: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,80 @@
+package httpform
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/mazrean/formstream"
+)
+
+// Schema registers the hooks processing the form of req to parser.
+// It runs for each request, so the hooks can use the request, e.g. its context.
+type Schema func(req *http.Request, parser *formstream.Parser) error
+
+type formContextKey struct{}
+
+// Middleware returns the middleware parsing the multipart body before the handler runs.
+// The hooks registered by schema run while parsing, and the buffered values and the results of the hooks
+// are passed to the handler in the request context. The handler reads them through FromContext.
+// The body is consumed, so the handler must not read it.
+// The requests that are not multipart/form-data are rejected with 415 Unsupported Media Type,
+// and the errors of parsing are responded with WriteError.
+func Middleware(schema Schema, options ...formstream.ParserOption) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			parser, err := NewParser(req, options...)
+			if errors.Is(err, http.ErrMissingBoundary) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+				return
+			}
+
+			err = schema(req, parser.Parser)
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+
+			err = parser.Parse()
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+
+			ctx := context.WithValue(req.Context(), formContextKey{}, &Form{parser: parser.Parser})
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// FromContext returns the form parsed by Middleware.
+// It returns false if ctx is not the context of a request passed through Middleware.
+func FromContext(ctx context.Context) (*Form, bool) {
+	form, ok := ctx.Value(formContextKey{}).(*Form)
+
+	return form, ok
+}
+
+// Form is the read-only view of the form parsed by Middleware.
+type Form struct {
+	parser *formstream.Parser
+}
+
+// Value first value of the key.
+func (f *Form) Value(key string) (string, formstream.Header, bool) {
+	return f.parser.Value(key)
+}
+
+// Values all values of the key.
+func (f *Form) Values(key string) ([]formstream.Value, bool) {
+	return f.parser.Values(key)
+}
+
+// Result first result of the stream hook named name.
+func (f *Form) Result(name string) (any, bool) {
+	return f.parser.Result(name)
+}
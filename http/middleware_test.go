@@ -0,0 +1,182 @@
+package httpform_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mazrean/formstream"
+	httpform "github.com/mazrean/formstream/http"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	const body = "--boundary\r\n" +
+		"Content-Disposition: form-data; name=\"name\"\r\n\r\n" +
+		"mazrean\r\n" +
+		"--boundary\r\n" +
+		"Content-Disposition: form-data; name=\"icon\"; filename=\"icon.png\"\r\n" +
+		"Content-Type: image/png\r\n\r\n" +
+		"icon contents\r\n" +
+		"--boundary--\r\n"
+
+	errSchema := errors.New("schema error")
+
+	tests := map[string]struct {
+		contentType    string
+		body           string
+		schemaErr      error
+		hookErr        error
+		expectedStatus int
+		expectedBody   string
+	}{
+		"normal": {
+			contentType:    "multipart/form-data; boundary=boundary",
+			body:           body,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "mazrean:13",
+		},
+		"not multipart": {
+			contentType:    "application/json",
+			body:           "{}",
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		"missing boundary": {
+			contentType:    "multipart/form-data",
+			body:           body,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"schema error": {
+			contentType:    "multipart/form-data; boundary=boundary",
+			body:           body,
+			schemaErr:      errSchema,
+			expectedStatus: http.StatusInternalServerError,
+		},
+		"hook error": {
+			contentType:    "multipart/form-data; boundary=boundary",
+			body:           body,
+			hookErr:        formstream.StatusError{Status: http.StatusConflict, Err: errors.New("user already exists")},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   "user already exists\n",
+		},
+		"too large": {
+			contentType:    "multipart/form-data; boundary=boundary",
+			body:           strings.Replace(body, "mazrean", strings.Repeat("a", 100), 1),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			schema := func(_ *http.Request, parser *formstream.Parser) error {
+				if tt.schemaErr != nil {
+					return tt.schemaErr
+				}
+
+				return parser.RegisterWithResult("icon", func(r io.Reader, _ formstream.Header, _ formstream.Dependencies) (any, error) {
+					if tt.hookErr != nil {
+						return nil, tt.hookErr
+					}
+
+					n, err := io.Copy(io.Discard, r)
+					return n, err
+				}, formstream.WithRequiredPart("name"))
+			}
+
+			handlerCalled := false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerCalled = true
+
+				form, ok := httpform.FromContext(r.Context())
+				if !ok {
+					t.Error("form is not in the context")
+					return
+				}
+
+				name, _, _ := form.Value("name")
+				size, _ := form.Result("icon")
+				_, _ = fmt.Fprintf(w, "%s:%v", name, size)
+			})
+
+			mw := httpform.Middleware(schema, formstream.WithMaxMemSize(50))
+
+			req := httptest.NewRequest(http.MethodPost, "/user", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+
+			mw(handler).ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("unexpected status code: expected %d, actual %d(%s)", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if handlerCalled != (tt.expectedStatus == http.StatusOK) {
+				t.Errorf("unexpected handler call: %t", handlerCalled)
+			}
+			if tt.expectedBody != "" && rec.Body.String() != tt.expectedBody {
+				t.Errorf("unexpected body: expected %q, actual %q", tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestFromContextWithoutMiddleware(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, ok := httpform.FromContext(req.Context()); ok {
+		t.Error("form must not be in the context")
+	}
+}
+
+func TestMiddleware_slowClient(t *testing.T) {
+	t.Parallel()
+
+	schema := func(_ *http.Request, parser *formstream.Parser) error {
+		return parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		})
+	}
+	handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("handler must not be called")
+	})
+	server := httptest.NewServer(httpform.Middleware(schema, formstream.WithIdleTimeout(50*time.Millisecond))(handler))
+	defer server.Close()
+
+	// the client stalls after the first bytes of the body
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		_, _ = pw.Write([]byte("--boundary\r\n" +
+			"Content-Disposition: form-data; name=\"stream\"\r\n\r\n" +
+			"aaa"))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to receive the response: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+}
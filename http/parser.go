@@ -1,9 +1,12 @@
 package httpform
 
 import (
+	"context"
+	"errors"
 	"io"
 	"mime"
 	"net/http"
+	"time"
 
 	"github.com/mazrean/formstream"
 )
@@ -11,6 +14,8 @@ import (
 type Parser struct {
 	*formstream.Parser
 	reader io.Reader
+	// ctx the context of the request, which cancels the parsing when the request is canceled
+	ctx context.Context
 }
 
 func NewParser(req *http.Request, options ...formstream.ParserOption) (*Parser, error) {
@@ -25,12 +30,33 @@ func NewParser(req *http.Request, options ...formstream.ParserOption) (*Parser,
 		return nil, http.ErrMissingBoundary
 	}
 
+	if encoding := req.Header.Get("Content-Encoding"); encoding != "" {
+		// the options given by the caller take precedence
+		options = append([]formstream.ParserOption{formstream.WithContentEncoding(encoding)}, options...)
+	}
+	if req.ContentLength >= 0 {
+		options = append([]formstream.ParserOption{formstream.WithContentLength(req.ContentLength)}, options...)
+	}
+
 	return &Parser{
 		Parser: formstream.NewParser(boundary, options...),
 		reader: req.Body,
+		ctx:    req.Context(),
 	}, nil
 }
 
 func (p *Parser) Parse() error {
-	return p.Parser.Parse(p.reader)
+	return p.Parser.ParseContext(p.ctx, p.reader)
+}
+
+// WriteError responds with the status code and the message for the error of parsing.
+// See formstream.StatusCode for the status codes.
+// For formstream.ErrClientTooSlow, it also unblocks the read of the body left running in background,
+// which would keep the response from being sent.
+func WriteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, formstream.ErrClientTooSlow) {
+		_ = http.NewResponseController(w).SetReadDeadline(time.Now())
+	}
+
+	http.Error(w, formstream.StatusMessage(err), formstream.StatusCode(err))
 }
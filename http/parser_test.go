@@ -458,3 +458,17 @@ func benchmarkStdMultipartReadForm(b *testing.B, fileSize formstream.DataSize) {
 		}
 	}
 }
+
+func TestWriteError(t *testing.T) {
+	t.Parallel()
+
+	rec := httptest.NewRecorder()
+	httpform.WriteError(rec, fmt.Errorf("failed to parse: %w", formstream.ErrTooLargeForm))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("unexpected status code: %d", rec.Code)
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != "Request Entity Too Large" {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
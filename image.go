@@ -0,0 +1,138 @@
+package formstream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"slices"
+)
+
+var (
+	// ErrUnsupportedImage is returned when the part is not an image of the allowed formats.
+	ErrUnsupportedImage = errors.New("unsupported image")
+	// ErrImageTooLarge is returned when the dimensions of the image exceed WithMaxImageSize.
+	ErrImageTooLarge = errors.New("image too large")
+)
+
+// ImageInfo is the metadata read from the header of an image.
+type ImageInfo struct {
+	Width  int
+	Height int
+	// Format the format name registered by image.RegisterFormat (e.g. "png", "jpeg").
+	Format string
+}
+
+type imageConfig struct {
+	maxWidth      int
+	maxHeight     int
+	formats       []string
+	maxHeaderSize DataSize
+}
+
+type ImageOption func(*imageConfig)
+
+// WithMaxImageSize sets the maximum width and height of the image in pixels.
+// 0 means no limit.
+func WithMaxImageSize(maxWidth, maxHeight int) ImageOption {
+	return func(c *imageConfig) {
+		c.maxWidth = maxWidth
+		c.maxHeight = maxHeight
+	}
+}
+
+// WithImageFormats sets the allowed formats (e.g. "png", "jpeg").
+// default: all the formats registered by image.RegisterFormat
+func WithImageFormats(formats ...string) ImageOption {
+	return func(c *imageConfig) {
+		c.formats = append(c.formats, formats...)
+	}
+}
+
+// WithMaxImageHeaderSize sets the maximum size read to decode the header of the image.
+// default: 64KB
+func WithMaxImageHeaderSize(maxHeaderSize DataSize) ImageOption {
+	return func(c *imageConfig) {
+		c.maxHeaderSize = maxHeaderSize
+	}
+}
+
+func newImageConfig(options []ImageOption) *imageConfig {
+	c := &imageConfig{
+		maxHeaderSize: 64 * KB,
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+
+	return c
+}
+
+// InspectImage reads the header of the image from r with image.DecodeConfig, without decoding the pixels.
+// It returns the metadata and a reader yielding the whole image, including the bytes read for the header,
+// so the image can be streamed to the destination after the inspection.
+// It fails with ErrUnsupportedImage if the format is not allowed or not registered,
+// and with ErrImageTooLarge if the image exceeds the limits.
+// The decoders of the formats must be registered, e.g. by importing image/png.
+func InspectImage(r io.Reader, options ...ImageOption) (ImageInfo, io.Reader, error) {
+	return newImageConfig(options).inspect(r)
+}
+
+// WithImageLimits rejects the part before the stream hook runs if it is not an image within the limits.
+// See InspectImage.
+// If the part is buffered (e.g. with WithForceSpool), the hook receives the buffered content rewound to the start,
+// so the optional interfaces (e.g. FileReader, io.ReaderAt) are kept.
+// Otherwise the hook receives a reader replaying the peeked header, which does not implement them.
+func WithImageLimits(options ...ImageOption) RegisterOption {
+	c := newImageConfig(options)
+
+	return func(rc *registerConfig) {
+		rc.filters = append(rc.filters, func(r io.Reader, _ Header) (io.Reader, error) {
+			seeker, ok := r.(io.Seeker)
+			if !ok {
+				_, r, err := c.inspect(r)
+				return r, err
+			}
+
+			_, _, err := c.inspect(r)
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = seeker.Seek(0, io.SeekStart)
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind: %w", err)
+			}
+
+			return r, nil
+		})
+	}
+}
+
+func (c *imageConfig) inspect(r io.Reader) (ImageInfo, io.Reader, error) {
+	peeked := &bytes.Buffer{}
+	config, format, err := image.DecodeConfig(io.TeeReader(io.LimitReader(r, int64(c.maxHeaderSize)), peeked))
+	if errors.Is(err, image.ErrFormat) {
+		return ImageInfo{}, nil, ErrUnsupportedImage
+	}
+	if err != nil {
+		return ImageInfo{}, nil, fmt.Errorf("failed to decode image config: %w", err)
+	}
+
+	info := ImageInfo{
+		Width:  config.Width,
+		Height: config.Height,
+		Format: format,
+	}
+
+	if len(c.formats) > 0 && !slices.Contains(c.formats, format) {
+		return info, nil, fmt.Errorf("%w: %s", ErrUnsupportedImage, format)
+	}
+
+	if (c.maxWidth > 0 && info.Width > c.maxWidth) || (c.maxHeight > 0 && info.Height > c.maxHeight) {
+		return info, nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, info.Width, info.Height)
+	}
+
+	return info, io.MultiReader(peeked, r), nil
+}
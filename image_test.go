@@ -0,0 +1,189 @@
+package formstream_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"github.com/mazrean/formstream"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	err := png.Encode(buf, image.NewGray(image.Rect(0, 0, width, height)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestInspectImage(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		data     []byte
+		options  []formstream.ImageOption
+		expected formstream.ImageInfo
+		err      error
+	}{
+		"png": {
+			data:     encodePNG(t, 20, 10),
+			expected: formstream.ImageInfo{Width: 20, Height: 10, Format: "png"},
+		},
+		"within limits": {
+			data: encodePNG(t, 20, 10),
+			options: []formstream.ImageOption{
+				formstream.WithMaxImageSize(20, 10),
+				formstream.WithImageFormats("png"),
+			},
+			expected: formstream.ImageInfo{Width: 20, Height: 10, Format: "png"},
+		},
+		"too wide": {
+			data:     encodePNG(t, 21, 10),
+			options:  []formstream.ImageOption{formstream.WithMaxImageSize(20, 10)},
+			expected: formstream.ImageInfo{Width: 21, Height: 10, Format: "png"},
+			err:      formstream.ErrImageTooLarge,
+		},
+		"too high": {
+			data:     encodePNG(t, 20, 11),
+			options:  []formstream.ImageOption{formstream.WithMaxImageSize(20, 10)},
+			expected: formstream.ImageInfo{Width: 20, Height: 11, Format: "png"},
+			err:      formstream.ErrImageTooLarge,
+		},
+		"format not allowed": {
+			data:     encodePNG(t, 20, 10),
+			options:  []formstream.ImageOption{formstream.WithImageFormats("jpeg")},
+			expected: formstream.ImageInfo{Width: 20, Height: 10, Format: "png"},
+			err:      formstream.ErrUnsupportedImage,
+		},
+		"not image": {
+			data: []byte(strings.Repeat("a", 100)),
+			err:  formstream.ErrUnsupportedImage,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			info, r, err := formstream.InspectImage(bytes.NewReader(tt.data), tt.options...)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if info != tt.expected {
+				t.Errorf("unexpected info: %+v", info)
+			}
+
+			if err != nil {
+				return
+			}
+
+			data, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tt.data) {
+				t.Error("content is not preserved")
+			}
+		})
+	}
+}
+
+func TestWithImageLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		width  int
+		spool  bool
+		called bool
+		err    error
+	}{
+		"within limits": {
+			width:  10,
+			called: true,
+		},
+		"buffered": {
+			width:  10,
+			spool:  true,
+			called: true,
+		},
+		"too large": {
+			width: 11,
+			err:   formstream.ErrImageTooLarge,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			data := encodePNG(t, tt.width, 10)
+
+			sb := &strings.Builder{}
+			mw := multipart.NewWriter(sb)
+			err := mw.SetBoundary(boundary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw, err := mw.CreateFormFile("icon", "icon.png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = fw.Write(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parser := formstream.NewParser(boundary)
+
+			options := []formstream.RegisterOption{formstream.WithImageLimits(formstream.WithMaxImageSize(10, 10))}
+			if tt.spool {
+				options = append(options, formstream.WithForceSpool())
+			}
+
+			called := false
+			err = parser.Register("icon", func(r io.Reader, _ formstream.Header) error {
+				called = true
+
+				if _, ok := r.(io.ReaderAt); tt.spool && !ok {
+					t.Errorf("buffered content is not kept: %T", r)
+				}
+
+				actual, err := io.ReadAll(r)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(actual, data) {
+					t.Error("content is not preserved")
+				}
+
+				return nil
+			}, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(strings.NewReader(sb.String()))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if called != tt.called {
+				t.Errorf("expected called=%v, got %v", tt.called, called)
+			}
+		})
+	}
+}
@@ -18,6 +18,10 @@ type ConditionJudger[K comparable, S any, T any] struct {
 	satisfiedHookMap   map[K]func(S) error
 	unsatisfiedHookMap map[K]*waitHook[K, S, T]
 	requirementHookMap map[K][]*waitHook[K, S, T]
+	// doneHookMap hooks waiting for the execution of the hook of the key
+	doneHookMap map[K][]*waitHook[K, S, T]
+	arrivedKeys map[K]struct{}
+	doneKeys    map[K]struct{}
 }
 
 type PreProcessFunc[S any, T any] func(S) (T, error)
@@ -27,7 +31,8 @@ type waitHook[K comparable, S any, T any] struct {
 	normalPathFunc   func(S) error
 	abnormalPathFunc func(T) error
 	callParams       []T
-	unsatisfiedCount int
+	requirement      Requirement[K]
+	satisfied        bool
 }
 
 type Hook[K comparable, S any, T any] interface {
@@ -36,15 +41,29 @@ type Hook[K comparable, S any, T any] interface {
 	Requirements() []K
 }
 
+// ConditionalHook is a Hook with a requirement in addition to the keys of Requirements.
+type ConditionalHook[K comparable, S any, T any] interface {
+	Hook[K, S, T]
+	// Requirement returns the additional requirement. nil means no additional requirement.
+	Requirement() Requirement[K]
+}
+
 func NewConditionJudger[K comparable, S any, T any](hookMap map[K]Hook[K, S, T], prepreProcessFunc PreProcessFunc[S, T]) *ConditionJudger[K, S, T] {
-	satisfiedHookMap := make(map[K]func(S) error, len(hookMap))
-	unsatisfiedHookMap := make(map[K]*waitHook[K, S, T])
-	requirementHookMap := make(map[K][]*waitHook[K, S, T])
+	w := &ConditionJudger[K, S, T]{
+		preProcessFunc:     prepreProcessFunc,
+		satisfiedHookMap:   make(map[K]func(S) error, len(hookMap)),
+		unsatisfiedHookMap: make(map[K]*waitHook[K, S, T]),
+		requirementHookMap: make(map[K][]*waitHook[K, S, T]),
+		doneHookMap:        make(map[K][]*waitHook[K, S, T]),
+		arrivedKeys:        make(map[K]struct{}),
+		doneKeys:           make(map[K]struct{}),
+	}
+
 	for key, hook := range hookMap {
-		requirements := hook.Requirements()
+		requirement := hookRequirement(hook)
 
-		if len(requirements) == 0 {
-			satisfiedHookMap[key] = hook.NormalPath
+		if requirement.Satisfied(w) {
+			w.satisfiedHookMap[key] = hook.NormalPath
 			continue
 		}
 
@@ -52,22 +71,56 @@ func NewConditionJudger[K comparable, S any, T any](hookMap map[K]Hook[K, S, T],
 			key:              key,
 			normalPathFunc:   hook.NormalPath,
 			abnormalPathFunc: hook.AbnormalPath,
-			unsatisfiedCount: len(requirements),
+			requirement:      requirement,
 		}
-		unsatisfiedHookMap[key] = hookValue
-		for _, requirePart := range requirements {
-			requirementHookMap[requirePart] = append(requirementHookMap[requirePart], hookValue)
+		w.unsatisfiedHookMap[key] = hookValue
+		addWaitHook(w.requirementHookMap, requirement.Keys(), hookValue)
+		addWaitHook(w.doneHookMap, requirement.Hooks(), hookValue)
+	}
+
+	return w
+}
+
+func hookRequirement[K comparable, S any, T any](hook Hook[K, S, T]) Requirement[K] {
+	keys := hook.Requirements()
+	reqs := make([]Requirement[K], 0, len(keys)+1)
+	for _, key := range keys {
+		reqs = append(reqs, Key(key))
+	}
+
+	if conditionalHook, ok := hook.(ConditionalHook[K, S, T]); ok {
+		if requirement := conditionalHook.Requirement(); requirement != nil {
+			reqs = append(reqs, requirement)
 		}
 	}
 
-	return &ConditionJudger[K, S, T]{
-		preProcessFunc:     prepreProcessFunc,
-		satisfiedHookMap:   satisfiedHookMap,
-		unsatisfiedHookMap: unsatisfiedHookMap,
-		requirementHookMap: requirementHookMap,
+	return All(reqs...)
+}
+
+func addWaitHook[K comparable, S any, T any](hookMap map[K][]*waitHook[K, S, T], keys []K, hook *waitHook[K, S, T]) {
+	registered := make(map[K]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := registered[key]; ok {
+			continue
+		}
+		registered[key] = struct{}{}
+
+		hookMap[key] = append(hookMap[key], hook)
 	}
 }
 
+// Arrived reports whether the key has arrived.
+func (w *ConditionJudger[K, S, T]) Arrived(key K) bool {
+	_, ok := w.arrivedKeys[key]
+	return ok
+}
+
+// Done reports whether the hook of the key has been executed successfully.
+func (w *ConditionJudger[K, S, T]) Done(key K) bool {
+	_, ok := w.doneKeys[key]
+	return ok
+}
+
 func (w *ConditionJudger[K, S, T]) IsHookExist(key K) bool {
 	if _, ok := w.satisfiedHookMap[key]; ok {
 		return true
@@ -86,6 +139,11 @@ func (w *ConditionJudger[K, S, T]) HookEvent(key K, value S) (bool, error) {
 			return false, fmt.Errorf("failed to execute hook: %w", err)
 		}
 
+		err = w.hookDone(key)
+		if err != nil {
+			return true, err
+		}
+
 		return true, nil
 	}
 
@@ -104,28 +162,49 @@ func (w *ConditionJudger[K, S, T]) HookEvent(key K, value S) (bool, error) {
 }
 
 func (w *ConditionJudger[K, S, T]) KeyEvent(key K) error {
-	hooks := w.requirementHookMap[key]
+	w.arrivedKeys[key] = struct{}{}
 
+	return w.runSatisfiedHooks(key, w.requirementHookMap[key])
+}
+
+// hookDone marks the hook of the key as executed and runs the hooks waiting for it.
+func (w *ConditionJudger[K, S, T]) hookDone(key K) error {
+	if w.Done(key) {
+		return nil
+	}
+	w.doneKeys[key] = struct{}{}
+
+	return w.runSatisfiedHooks(key, w.doneHookMap[key])
+}
+
+func (w *ConditionJudger[K, S, T]) runSatisfiedHooks(key K, hooks []*waitHook[K, S, T]) error {
 	var errs []error
 	for _, hook := range hooks {
-		if hook.unsatisfiedCount <= 0 {
-			continue
-		}
-		hook.unsatisfiedCount--
-		if hook.unsatisfiedCount > 0 {
+		if hook.satisfied || !hook.requirement.Satisfied(w) {
 			continue
 		}
+		hook.satisfied = true
 
 		delete(w.unsatisfiedHookMap, hook.key)
 		w.satisfiedHookMap[hook.key] = hook.normalPathFunc
 
+		executed := false
 		for _, param := range hook.callParams {
 			err := hook.abnormalPathFunc(param)
 			if err != nil {
 				errs = append(errs, fmt.Errorf("failed to execute hook(%v): %w", key, err))
+				continue
 			}
+			executed = true
 		}
 		hook.callParams = nil
+
+		if executed {
+			err := w.hookDone(hook.key)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
 	}
 	if len(errs) != 0 {
 		return errors.Join(errs...)
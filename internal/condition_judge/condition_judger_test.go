@@ -3,6 +3,7 @@ package conditionjudge_test
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"testing"
 
 	conditionjudge "github.com/mazrean/formstream/internal/condition_judge"
@@ -12,6 +13,7 @@ var errTest = errors.New("test error")
 
 type mockHook struct {
 	requirements      []string
+	condition         conditionjudge.Requirement[string]
 	err               error
 	lastNormalValue   string
 	lastAbnormalValue string
@@ -39,6 +41,10 @@ func (h *mockHook) Requirements() []string {
 	return h.requirements
 }
 
+func (h *mockHook) Requirement() conditionjudge.Requirement[string] {
+	return h.condition
+}
+
 func preProcessFunc(value string) (string, error) {
 	return fmt.Sprintf("abnormal:%s", value), nil
 }
@@ -157,6 +163,124 @@ func TestConditionJudger(t *testing.T) {
 				{"hook", "stream2", "two", nil, "stream2", "normal", "two"},
 			},
 		},
+		"duplicate key": {
+			hooks: map[string]*mockHook{
+				"stream": {
+					requirements: []string{"field", "field2"},
+				},
+			},
+			events: []event{
+				{"key", "field", "", nil, "", "", ""},
+				{"key", "field", "", nil, "", "", ""},
+				{"hook", "stream", "one", nil, "", "", ""},
+				{"key", "field2", "", nil, "stream", "abnormal", "abnormal:one"},
+			},
+		},
+		"any": {
+			hooks: map[string]*mockHook{
+				"stream": {
+					condition: conditionjudge.Any(conditionjudge.Key("field"), conditionjudge.Key("field2")),
+				},
+			},
+			events: []event{
+				{"hook", "stream", "one", nil, "", "", ""},
+				{"key", "field2", "", nil, "stream", "abnormal", "abnormal:one"},
+				{"key", "field", "", nil, "", "", ""},
+				{"hook", "stream", "two", nil, "stream", "normal", "two"},
+			},
+		},
+		"any and requirements": {
+			hooks: map[string]*mockHook{
+				"stream": {
+					requirements: []string{"field"},
+					condition:    conditionjudge.Any(conditionjudge.Key("field2"), conditionjudge.Key("field3")),
+				},
+			},
+			events: []event{
+				{"key", "field3", "", nil, "", "", ""},
+				{"hook", "stream", "one", nil, "", "", ""},
+				{"key", "field", "", nil, "stream", "abnormal", "abnormal:one"},
+			},
+		},
+		"predicate(satisfied)": {
+			hooks: map[string]*mockHook{
+				"stream": {
+					condition: conditionjudge.All(
+						conditionjudge.Key("field"),
+						conditionjudge.Any(
+							conditionjudge.Predicate[string](func() bool { return true }),
+							conditionjudge.Key("field2"),
+						),
+					),
+				},
+			},
+			events: []event{
+				{"key", "field", "", nil, "", "", ""},
+				{"hook", "stream", "one", nil, "stream", "normal", "one"},
+			},
+		},
+		"predicate(unsatisfied)": {
+			hooks: map[string]*mockHook{
+				"stream": {
+					condition: conditionjudge.All(
+						conditionjudge.Key("field"),
+						conditionjudge.Any(
+							conditionjudge.Predicate[string](func() bool { return false }),
+							conditionjudge.Key("field2"),
+						),
+					),
+				},
+			},
+			events: []event{
+				{"key", "field", "", nil, "", "", ""},
+				{"hook", "stream", "one", nil, "", "", ""},
+				{"key", "field2", "", nil, "stream", "abnormal", "abnormal:one"},
+			},
+		},
+		"done": {
+			hooks: map[string]*mockHook{
+				"stream": {},
+				"stream2": {
+					condition: conditionjudge.Done[string]("stream"),
+				},
+			},
+			events: []event{
+				{"hook", "stream2", "two", nil, "", "", ""},
+				{"hook", "stream", "one", nil, "stream", "normal", "one"},
+				{"key", "stream", "", nil, "stream2", "abnormal", "abnormal:two"},
+				{"hook", "stream2", "three", nil, "stream2", "normal", "three"},
+			},
+		},
+		"done(chain)": {
+			hooks: map[string]*mockHook{
+				"stream": {
+					requirements: []string{"field"},
+				},
+				"stream2": {
+					condition: conditionjudge.Done[string]("stream"),
+				},
+			},
+			events: []event{
+				{"hook", "stream2", "two", nil, "", "", ""},
+				{"hook", "stream", "one", nil, "", "", ""},
+				{"key", "field", "", nil, "stream", "abnormal", "abnormal:one"},
+				{"key", "stream", "", nil, "stream2", "abnormal", "abnormal:two"},
+			},
+		},
+		"done(error)": {
+			hooks: map[string]*mockHook{
+				"stream": {
+					err: errTest,
+				},
+				"stream2": {
+					condition: conditionjudge.Done[string]("stream"),
+				},
+			},
+			events: []event{
+				{"hook", "stream2", "two", nil, "", "", ""},
+				{"hook", "stream", "one", errTest, "", "", ""},
+			},
+		},
 	}
 
 	for name, tt := range tests {
@@ -208,3 +332,68 @@ func TestConditionJudger(t *testing.T) {
 		})
 	}
 }
+
+func TestDetectCycle(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		graph map[string][]string
+		cycle []string
+	}{
+		"no cycle": {
+			graph: map[string][]string{
+				"a": {"b"},
+				"b": {"c"},
+			},
+		},
+		"self": {
+			graph: map[string][]string{
+				"a": {"a"},
+			},
+			cycle: []string{"a"},
+		},
+		"cycle": {
+			graph: map[string][]string{
+				"a": {"b"},
+				"b": {"c"},
+				"c": {"a"},
+			},
+			cycle: []string{"a", "b", "c"},
+		},
+		"diamond": {
+			graph: map[string][]string{
+				"a": {"b", "c"},
+				"b": {"d"},
+				"c": {"d"},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := conditionjudge.DetectCycle(tt.graph)
+
+			var cycleErr *conditionjudge.CycleError[string]
+			if !errors.As(err, &cycleErr) {
+				if tt.cycle != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if tt.cycle == nil {
+				t.Fatalf("unexpected cycle: %v", err)
+			}
+
+			if len(cycleErr.Cycle) != len(tt.cycle) {
+				t.Fatalf("unexpected cycle: %v", cycleErr.Cycle)
+			}
+			for _, key := range tt.cycle {
+				if !slices.Contains(cycleErr.Cycle, key) {
+					t.Errorf("%s is not in cycle: %v", key, cycleErr.Cycle)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package conditionjudge
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CycleError is returned when hooks wait for the execution of each other.
+type CycleError[K comparable] struct {
+	// Cycle the hooks in the cycle. The last hook waits for the first hook.
+	Cycle []K
+}
+
+func (e *CycleError[K]) Error() string {
+	keys := make([]string, 0, len(e.Cycle)+1)
+	for _, key := range e.Cycle {
+		keys = append(keys, fmt.Sprint(key))
+	}
+	if len(e.Cycle) > 0 {
+		keys = append(keys, fmt.Sprint(e.Cycle[0]))
+	}
+
+	return fmt.Sprintf("dependency cycle: %s", strings.Join(keys, " -> "))
+}
+
+// DetectCycle returns *CycleError if the hooks wait for the execution of each other.
+// graph maps each hook to the hooks it waits for.
+func DetectCycle[K comparable](graph map[K][]K) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	states := make(map[K]int, len(graph))
+	var stack []K
+
+	var visit func(key K) []K
+	visit = func(key K) []K {
+		switch states[key] {
+		case visiting:
+			for i, k := range stack {
+				if k == key {
+					return append([]K{}, stack[i:]...)
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		states[key] = visiting
+		stack = append(stack, key)
+		for _, next := range graph[key] {
+			if cycle := visit(next); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		states[key] = visited
+
+		return nil
+	}
+
+	for key := range graph {
+		if states[key] != unvisited {
+			continue
+		}
+
+		if cycle := visit(key); cycle != nil {
+			return &CycleError[K]{Cycle: cycle}
+		}
+	}
+
+	return nil
+}
+
+// StronglyConnectedComponents returns the strongly connected components of the graph.
+// Two keys are in the same component if and only if they are on a common cycle.
+func StronglyConnectedComponents[K comparable](graph map[K][]K) [][]K {
+	var (
+		index      int
+		indexes    = make(map[K]int, len(graph))
+		lowLinks   = make(map[K]int, len(graph))
+		onStack    = make(map[K]bool, len(graph))
+		stack      []K
+		components [][]K
+	)
+
+	var connect func(key K)
+	connect = func(key K) {
+		indexes[key] = index
+		lowLinks[key] = index
+		index++
+		stack = append(stack, key)
+		onStack[key] = true
+
+		for _, next := range graph[key] {
+			if _, ok := indexes[next]; !ok {
+				connect(next)
+				lowLinks[key] = min(lowLinks[key], lowLinks[next])
+			} else if onStack[next] {
+				lowLinks[key] = min(lowLinks[key], indexes[next])
+			}
+		}
+
+		if lowLinks[key] != indexes[key] {
+			return
+		}
+
+		var component []K
+		for {
+			k := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[k] = false
+			component = append(component, k)
+			if k == key {
+				break
+			}
+		}
+		components = append(components, component)
+	}
+
+	for key := range graph {
+		if _, ok := indexes[key]; !ok {
+			connect(key)
+		}
+	}
+
+	return components
+}
@@ -0,0 +1,143 @@
+package conditionjudge
+
+// Requirement is a condition on the arrived keys and the executed hooks to run a hook.
+type Requirement[K comparable] interface {
+	// Keys returns the keys whose arrival may change the result of Satisfied.
+	Keys() []K
+	// Hooks returns the hooks whose execution may change the result of Satisfied.
+	Hooks() []K
+	// Satisfied reports whether the requirement is met.
+	Satisfied(state State[K]) bool
+}
+
+// State is the progress of the events.
+type State[K comparable] interface {
+	// Arrived reports whether the key has arrived.
+	Arrived(key K) bool
+	// Done reports whether the hook has been executed successfully.
+	Done(key K) bool
+}
+
+type keyRequirement[K comparable] struct {
+	key K
+}
+
+// Key requires the key to arrive.
+func Key[K comparable](key K) Requirement[K] {
+	return keyRequirement[K]{key: key}
+}
+
+func (r keyRequirement[K]) Keys() []K {
+	return []K{r.key}
+}
+
+func (keyRequirement[K]) Hooks() []K {
+	return nil
+}
+
+func (r keyRequirement[K]) Satisfied(state State[K]) bool {
+	return state.Arrived(r.key)
+}
+
+type doneRequirement[K comparable] struct {
+	key K
+}
+
+// Done requires the hook of the key to be executed successfully.
+func Done[K comparable](key K) Requirement[K] {
+	return doneRequirement[K]{key: key}
+}
+
+func (doneRequirement[K]) Keys() []K {
+	return nil
+}
+
+func (r doneRequirement[K]) Hooks() []K {
+	return []K{r.key}
+}
+
+func (r doneRequirement[K]) Satisfied(state State[K]) bool {
+	return state.Done(r.key)
+}
+
+type allRequirement[K comparable] []Requirement[K]
+
+// All requires all of the requirements.
+// All with no requirements is always satisfied.
+func All[K comparable](reqs ...Requirement[K]) Requirement[K] {
+	return allRequirement[K](reqs)
+}
+
+func (r allRequirement[K]) Keys() []K {
+	return collectKeys(r, Requirement[K].Keys)
+}
+
+func (r allRequirement[K]) Hooks() []K {
+	return collectKeys(r, Requirement[K].Hooks)
+}
+
+func (r allRequirement[K]) Satisfied(state State[K]) bool {
+	for _, req := range r {
+		if !req.Satisfied(state) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type anyRequirement[K comparable] []Requirement[K]
+
+// Any requires at least one of the requirements.
+// Any with no requirements is never satisfied.
+func Any[K comparable](reqs ...Requirement[K]) Requirement[K] {
+	return anyRequirement[K](reqs)
+}
+
+func (r anyRequirement[K]) Keys() []K {
+	return collectKeys(r, Requirement[K].Keys)
+}
+
+func (r anyRequirement[K]) Hooks() []K {
+	return collectKeys(r, Requirement[K].Hooks)
+}
+
+func (r anyRequirement[K]) Satisfied(state State[K]) bool {
+	for _, req := range r {
+		if req.Satisfied(state) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type predicateRequirement[K comparable] func() bool
+
+// Predicate requires fn to return true.
+// fn is evaluated only when a key of the enclosing requirement arrives or a hook of it is executed,
+// so it should depend only on the values of those keys.
+func Predicate[K comparable](fn func() bool) Requirement[K] {
+	return predicateRequirement[K](fn)
+}
+
+func (predicateRequirement[K]) Keys() []K {
+	return nil
+}
+
+func (predicateRequirement[K]) Hooks() []K {
+	return nil
+}
+
+func (r predicateRequirement[K]) Satisfied(State[K]) bool {
+	return r()
+}
+
+func collectKeys[K comparable](reqs []Requirement[K], keysFunc func(Requirement[K]) []K) []K {
+	var keys []K
+	for _, req := range reqs {
+		keys = append(keys, keysFunc(req)...)
+	}
+
+	return keys
+}
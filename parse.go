@@ -2,12 +2,15 @@ package formstream
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"mime/multipart"
-	"os"
+	"slices"
 	"sync"
+	"time"
 
 	conditionjudge "github.com/mazrean/formstream/internal/condition_judge"
 )
@@ -19,11 +22,25 @@ var (
 	ErrTooManyHeaders = errors.New("too many headers")
 	// ErrTooLargeForm is returned when the form is too large for the parser to handle within the memory limit.
 	ErrTooLargeForm = errors.New("too large form")
+	// ErrOutOfOrder is returned when a part for a stream hook arrives before its required parts with WithStrictOrder.
+	ErrOutOfOrder = errors.New("part arrived before its required parts")
 )
 
 // Parse parses the multipart form from r.
-func (p *Parser) Parse(r io.Reader) (err error) {
-	hsc := newHookSatisfactionChecker(p.hookMap, &p.parserConfig)
+func (p *Parser) Parse(r io.Reader) error {
+	return p.ParseContext(context.Background(), r)
+}
+
+// ParseContext parses the multipart form from r.
+// It stops reading and fails with the error of ctx when ctx is done, even while waiting for the rate limits.
+func (p *Parser) ParseContext(ctx context.Context, r io.Reader) (err error) {
+	// the requirements of parts do not block the hooks, so only Validate reports them
+	err = p.validate(false)
+	if err != nil {
+		return err
+	}
+
+	hsc := newHookSatisfactionChecker(ctx, p)
 	defer func() {
 		deferErr := hsc.Close()
 		// capture the error of Close()
@@ -36,12 +53,52 @@ func (p *Parser) Parse(r io.Reader) (err error) {
 		}
 	}()
 
-	err = p.parse(r, hsc.IConditionJudger)
+	r, stop := p.limitReader(ctx, r)
+	defer stop()
+
+	r, closeDecoder, err := p.decode(r, p.contentEncoding)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := closeDecoder()
+		if closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close decoder: %w", closeErr))
+		}
+	}()
+
+	err = p.parse(r, hsc.IConditionJudger, hsc.preProcessor)
+	p.progress.finish()
 
 	return
 }
 
-func (p *Parser) parse(r io.Reader, hsc conditionjudge.IConditionJudger[string, *normalParam, *abnormalParam]) error {
+// limitReader applies the limits of reading the body to r: ctx, WithIdleTimeout, WithMinThroughput and the rate limits.
+// It also sets up the progress of WithProgress. stop stops the background read of the slow client check.
+func (p *Parser) limitReader(ctx context.Context, r io.Reader) (_ io.Reader, stop func()) {
+	stop = func() {}
+
+	r = contextReader{ctx: ctx, r: r}
+	if p.idleTimeout > 0 || p.minThroughput > 0 {
+		sr := p.newSlowClientReader(ctx, r)
+		stop = sr.Close
+		r = sr
+	}
+	for _, l := range []*RateLimiter{p.rateLimiter, p.rateLimit.newRateLimiter()} {
+		if l != nil {
+			r = &rateLimitedReader{ctx: ctx, r: r, l: l}
+		}
+	}
+
+	if p.progressFunc != nil {
+		p.progress = p.newProgressReader(r)
+		r = p.progress
+	}
+
+	return r, stop
+}
+
+func (p *Parser) parse(r io.Reader, hsc conditionjudge.IConditionJudger[string, *normalParam, *abnormalParam], pp *preProcessor) error {
 	mr := multipart.NewReader(r, p.boundary)
 	for {
 		var part *multipart.Part
@@ -50,7 +107,7 @@ func (p *Parser) parse(r io.Reader, hsc conditionjudge.IConditionJudger[string,
 			if errors.Is(err, io.EOF) {
 				break
 			}
-			return fmt.Errorf("failed to read next part: %w", err)
+			return fmt.Errorf("%w: failed to read next part: %w", ErrMalformed, err)
 		}
 
 		if p.maxParts == 0 {
@@ -65,43 +122,104 @@ func (p *Parser) parse(r io.Reader, hsc conditionjudge.IConditionJudger[string,
 			p.maxHeaders -= uint(len(header))
 		}
 
-		header := newHeader(part.Header)
-		if hsc.IsHookExist(part.FormName()) {
-			_, err := hsc.HookEvent(part.FormName(), &normalParam{
-				r: part,
-				h: header,
-			})
-			if err != nil {
-				return fmt.Errorf("failed to run or set hook: %w", err)
-			}
-		} else {
-			b := new(bytes.Buffer)
+		p.progress.setPart(part.FormName())
 
-			if DataSize(len(part.FormName())) > p.maxMemSize {
-				return ErrTooLargeForm
-			}
-			p.maxMemSize -= DataSize(len(part.FormName()))
+		err = p.parsePart(part, hsc, pp)
+		if err != nil {
+			return err
+		}
+	}
 
-			n, err := io.Copy(b, part)
-			if err != nil {
-				return fmt.Errorf("failed to copy part: %w", err)
-			}
+	return nil
+}
+
+// parsePart passes the part to the hook or stores its value.
+// The memory for the values is reserved from the budget through pp.
+func (p *Parser) parsePart(part *multipart.Part, hsc conditionjudge.IConditionJudger[string, *normalParam, *abnormalParam], pp *preProcessor) (err error) {
+	header := newHeader(part.Header)
+	isHook := hsc.IsHookExist(part.FormName())
+	if isHook {
+		// the header is checked before the decoder reads the body
+		accepted, err := p.checkHeader(part, header)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return nil
+		}
+	}
 
-			if uint64(n) > uint64(p.maxMemSize) {
-				return ErrTooLargeForm
+	// the errors of reading the part are of the client, even if a hook returns them
+	var r io.Reader = bodyReader{r: part}
+	if p.decoders != nil {
+		encoding := part.Header.Get("Content-Encoding")
+
+		var closeDecoder func() error
+		r, closeDecoder, err = p.decode(r, encoding)
+		if err != nil {
+			return fmt.Errorf("%w: failed to decode part(%s): %w", ErrMalformed, part.FormName(), err)
+		}
+		defer func() {
+			closeErr := closeDecoder()
+			if closeErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to close decoder: %w", closeErr))
 			}
-			p.maxMemSize -= DataSize(n)
+		}()
 
-			p.valueMap[part.FormName()] = append(p.valueMap[part.FormName()], Value{
-				content: b.Bytes(),
-				header:  header,
-			})
+		if encoding != "" {
+			// header shares the map, so the hook does not see the encoding
+			part.Header.Del("Content-Encoding")
 		}
+	}
 
-		err = hsc.KeyEvent(part.FormName())
+	if isHook {
+		_, err = hsc.HookEvent(part.FormName(), &normalParam{
+			r:          r,
+			h:          header,
+			forceSpool: p.hookMap[part.FormName()].forceSpool,
+		})
 		if err != nil {
-			return fmt.Errorf("failed to run satisfied hook: %w", err)
+			return fmt.Errorf("failed to run or set hook: %w", err)
 		}
+	} else {
+		b := new(bytes.Buffer)
+
+		if DataSize(len(part.FormName())) > p.maxMemSize {
+			return ErrTooLargeForm
+		}
+		p.maxMemSize -= DataSize(len(part.FormName()))
+
+		err = pp.reserveValue(DataSize(len(part.FormName())))
+		if err != nil {
+			return err
+		}
+
+		// read one more byte to detect the limit violation without reading the whole part
+		mw := &memoryWriter{pp: pp, buf: b}
+		n, err := io.Copy(mw, io.LimitReader(r, int64(min(p.maxMemSize, math.MaxInt64-1))+1))
+		pp.valueReserved += mw.reserved
+		if errors.Is(err, errBudgetSpill) {
+			// the values are kept on memory
+			return ErrBudgetExceeded
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy part: %w", err)
+		}
+
+		if uint64(n) > uint64(p.maxMemSize) {
+			return ErrTooLargeForm
+		}
+		p.maxMemSize -= DataSize(n)
+
+		p.valueMap[part.FormName()] = append(p.valueMap[part.FormName()], Value{
+			content: b.Bytes(),
+			header:  header,
+		})
+	}
+
+	err = hsc.KeyEvent(part.FormName())
+	if err != nil {
+		return fmt.Errorf("failed to run satisfied hook: %w", err)
 	}
 
 	return nil
@@ -112,15 +230,35 @@ type hookSatisfactionChecker struct {
 	preProcessor *preProcessor
 }
 
-func newHookSatisfactionChecker(streamHooks map[string]streamHook, config *parserConfig) *hookSatisfactionChecker {
-	judgeHooks := make(map[string]conditionjudge.Hook[string, *normalParam, *abnormalParam], len(streamHooks))
-	for name, hook := range streamHooks {
-		h := judgeHook(hook)
-		judgeHooks[name] = &h
+func newHookSatisfactionChecker(ctx context.Context, p *Parser) *hookSatisfactionChecker {
+	preProcess := &preProcessor{
+		config: &p.parserConfig,
+		ctx:    ctx,
 	}
 
-	preProcess := &preProcessor{
-		config: config,
+	judgeHooks := make(map[string]conditionjudge.Hook[string, *normalParam, *abnormalParam], len(p.hookMap))
+	for name, hook := range p.hookMap {
+		judgeHooks[name] = &judgeHook{
+			name:         name,
+			fn:           hook.fn,
+			hasResult:    hook.hasResult,
+			resultMap:    p.resultMap,
+			requireParts: hook.requireParts,
+			requirement:  conditionjudge.All(buildRequirements(hook.requirements, p.valueMap)...),
+			retry:        hook.retry,
+			spool:        hook.spool,
+			preProcessor: preProcess,
+			unconsumed:   p.unconsumedPolicy,
+			stats:        &p.stats,
+			ctx:          ctx,
+			limiter:      hook.rateLimit.newRateLimiter(),
+			deps: Dependencies{
+				valueMap:  p.valueMap,
+				names:     append(slices.Clone(hook.requireParts), requirementNames(hook.requirements)...),
+				resultMap: p.resultMap,
+				results:   requirementResults(hook.requirements),
+			},
+		}
 	}
 
 	return &hookSatisfactionChecker{
@@ -136,17 +274,37 @@ func (wh *hookSatisfactionChecker) Close() error {
 type normalParam struct {
 	r io.Reader
 	h Header
+	// forceSpool the hook always reads the part buffered, by WithForceSpool
+	forceSpool bool
 }
 
 type abnormalParam struct {
-	content io.ReadCloser
+	content bufferedContent
 	header  Header
 }
 
+// bufferedContent is the content of a part buffered on memory or disk.
+// It can be read again from the start, so hooks on the abnormal path can be retried.
+type bufferedContent interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+}
+
 type preProcessor struct {
 	config *parserConfig
-	offset int64
-	file   *os.File
+	// ctx the context of the parsing, which cancels waiting for the budget
+	ctx context.Context
+	// memReserved, diskReserved the sizes reserved from the budget by the parser
+	memReserved  DataSize
+	diskReserved DataSize
+	// memoryContents the close functions of the contents buffered on memory and not closed yet
+	memoryContents map[*bytes.Buffer]func() error
+	// valueReserved the memory reserved for the values, released when the parsing ends
+	valueReserved DataSize
+	// file the temp file shared by the parts
+	file *spillFile
+	// partFiles the temp files of the parts not closed yet, with WithSpillFilePerPart
+	partFiles map[*spillFile]struct{}
 }
 
 var bufPool = sync.Pool{
@@ -156,6 +314,10 @@ var bufPool = sync.Pool{
 }
 
 func (pp *preProcessor) run(normalParam *normalParam) (*abnormalParam, error) {
+	if pp.config.strictOrder && !normalParam.forceSpool {
+		return nil, fmt.Errorf("%w: %s", ErrOutOfOrder, normalParam.h.Name())
+	}
+
 	buf, ok := bufPool.Get().(*bytes.Buffer)
 	if !ok {
 		buf = new(bytes.Buffer)
@@ -163,49 +325,39 @@ func (pp *preProcessor) run(normalParam *normalParam) (*abnormalParam, error) {
 	buf.Reset()
 
 	memLimit := min(pp.config.maxMemFileSize, pp.config.maxMemSize)
-	n, err := io.CopyN(buf, normalParam.r, int64(memLimit)+1)
-	if err != nil && !errors.Is(err, io.EOF) {
+	mw := &memoryWriter{pp: pp, buf: buf}
+	n, err := io.CopyN(mw, normalParam.r, int64(memLimit)+1)
+	spill := errors.Is(err, errBudgetSpill)
+	if err != nil && !spill && !errors.Is(err, io.EOF) {
+		pp.releaseMemory(mw.reserved)
+		bufPool.Put(buf)
 		return nil, fmt.Errorf("failed to copy: %w", err)
 	}
 
-	var content io.ReadCloser
-	if DataSize(n) > memLimit {
-		if pp.file == nil {
-			f, err := os.CreateTemp("", "formstream-")
-			if err != nil {
-				return nil, fmt.Errorf("failed to create temp file: %w", err)
-			}
-			pp.file = f
+	var content bufferedContent
+	if !spill && DataSize(n) <= memLimit {
+		content = pp.memoryContent(buf)
+	} else {
+		f, err := pp.spillFile()
+		if err != nil {
+			pp.releaseMemory(mw.reserved)
+			bufPool.Put(buf)
+			return nil, err
 		}
 
-		bufSize, err := io.Copy(pp.file, buf)
+		bufSize, err := io.Copy(diskWriter{pp: pp, file: f}, buf)
+		pp.releaseMemory(mw.reserved)
+		bufPool.Put(buf)
 		if err != nil {
 			return nil, fmt.Errorf("failed to write: %w", err)
 		}
 
-		remainSize, err := io.Copy(pp.file, normalParam.r)
+		remainSize, err := io.Copy(diskWriter{pp: pp, file: f}, normalParam.r)
 		if err != nil {
 			return nil, fmt.Errorf("failed to copy: %w", err)
 		}
 
-		size := bufSize + remainSize
-		content = io.NopCloser(io.NewSectionReader(pp.file, pp.offset, size))
-		pp.offset += size
-
-		bufPool.Put(buf)
-	} else {
-		pp.config.maxMemSize -= DataSize(buf.Len())
-		pp.config.maxMemFileSize -= DataSize(buf.Len())
-		bufSize := buf.Len()
-		content = customReadCloser{
-			Reader: buf,
-			closeFunc: func() error {
-				bufPool.Put(buf)
-				pp.config.maxMemSize += DataSize(bufSize)
-				pp.config.maxMemFileSize += DataSize(bufSize)
-				return nil
-			},
-		}
+		content = pp.fileContent(f, bufSize+remainSize)
 	}
 
 	return &abnormalParam{
@@ -214,51 +366,199 @@ func (pp *preProcessor) run(normalParam *normalParam) (*abnormalParam, error) {
 	}, nil
 }
 
-func (pp *preProcessor) Close() error {
-	if pp.file == nil {
+// memoryContent returns the content of buf.
+// buf is returned to the pool when the content is closed, or when the preProcessor is closed if the hook never runs.
+// The memory for buf must be reserved from the budget in advance (see memoryWriter), and it is released along with buf.
+func (pp *preProcessor) memoryContent(buf *bytes.Buffer) bufferedContent {
+	pp.config.maxMemSize -= DataSize(buf.Len())
+	pp.config.maxMemFileSize -= DataSize(buf.Len())
+	bufSize := buf.Len()
+
+	closeFunc := func() error {
+		if _, ok := pp.memoryContents[buf]; !ok {
+			// already closed
+			return nil
+		}
+		delete(pp.memoryContents, buf)
+
+		bufPool.Put(buf)
+		pp.config.maxMemSize += DataSize(bufSize)
+		pp.config.maxMemFileSize += DataSize(bufSize)
+		pp.releaseMemory(DataSize(bufSize))
 		return nil
 	}
 
-	filepath := pp.file.Name()
-
-	// Close the file handle first
-	closeErr := pp.file.Close()
-
-	// Remove the temporary file from disk
-	removeErr := os.Remove(filepath)
-
-	// Return combined errors if any
-	if closeErr != nil || removeErr != nil {
-		return errors.Join(closeErr, removeErr)
+	if pp.memoryContents == nil {
+		pp.memoryContents = make(map[*bytes.Buffer]func() error)
 	}
+	pp.memoryContents[buf] = closeFunc
 
-	return nil
+	return customReadCloser{
+		SectionReader: io.NewSectionReader(bytes.NewReader(buf.Bytes()), 0, int64(bufSize)),
+		closeFunc:     closeFunc,
+	}
 }
 
 type judgeHook struct {
-	fn           StreamHookFunc
+	name         string
+	fn           StreamHookWithResultFunc
+	hasResult    bool
+	resultMap    map[string][]any
 	requireParts []string
+	requirement  conditionjudge.Requirement[string]
+	deps         Dependencies
+	retry        retryConfig
+	spool        spoolConfig
+	preProcessor *preProcessor
+	unconsumed   UnconsumedPolicy
+	stats        *Stats
+	ctx          context.Context
+	// limiter the rate limit of the hook. nil means no limit.
+	limiter *RateLimiter
 }
 
 func (jh judgeHook) NormalPath(normalParam *normalParam) error {
-	return jh.fn(normalParam.r, normalParam.h)
+	if normalParam.forceSpool {
+		abnormalParam, err := jh.preProcessor.run(normalParam)
+		if err != nil {
+			return err
+		}
+
+		return jh.AbnormalPath(abnormalParam)
+	}
+
+	if !jh.spool.enabled {
+		err := jh.call(normalParam.r, normalParam.h, jh.deps)
+		if err != nil {
+			return err
+		}
+
+		return jh.consumeRest(normalParam.r)
+	}
+
+	sp := jh.preProcessor.newSpool(jh.spool.maxDiskSize)
+	err := jh.call(io.TeeReader(normalParam.r, sp), normalParam.h, jh.deps)
+	if err == nil {
+		sp.discard()
+		return jh.consumeRest(normalParam.r)
+	}
+	if jh.retry.maxRetries == 0 {
+		sp.discard()
+		return err
+	}
+
+	// read the rest of the part so that the spooled copy is complete
+	_, copyErr := io.Copy(sp, normalParam.r)
+	if copyErr != nil {
+		sp.discard()
+		return errors.Join(err, fmt.Errorf("failed to copy: %w", copyErr))
+	}
+
+	content, spoolErr := sp.content()
+	if spoolErr != nil {
+		return errors.Join(err, spoolErr)
+	}
+	defer content.Close()
+
+	err = jh.runWithRetry(content, normalParam.h, err)
+	if err != nil {
+		return err
+	}
+
+	return jh.consumeRest(content)
 }
 
 func (jh judgeHook) AbnormalPath(abnoramlParam *abnormalParam) error {
 	defer abnoramlParam.content.Close()
 
-	return jh.fn(abnoramlParam.content, abnoramlParam.header)
+	err := jh.call(abnoramlParam.content, abnoramlParam.header, jh.deps)
+
+	err = jh.runWithRetry(abnoramlParam.content, abnoramlParam.header, err)
+	if err != nil {
+		return err
+	}
+
+	return jh.consumeRest(abnoramlParam.content)
+}
+
+// call runs the hook and stores its result.
+func (jh judgeHook) call(r io.Reader, header Header, deps Dependencies) error {
+	if jh.limiter != nil {
+		r = &rateLimitedReader{ctx: jh.ctx, r: r, l: jh.limiter}
+	}
+
+	result, err := jh.fn(r, header, deps)
+	if err != nil {
+		return HookError{Name: jh.name, Err: err}
+	}
+
+	if jh.hasResult {
+		jh.resultMap[jh.name] = append(jh.resultMap[jh.name], result)
+	}
+
+	return nil
+}
+
+// runWithRetry re-runs the hook on the buffered content while it fails and retries remain.
+// err is the error of the first run.
+func (jh judgeHook) runWithRetry(content bufferedContent, header Header, err error) error {
+	for retried := uint(1); err != nil && retried <= jh.retry.maxRetries; retried++ {
+		_, seekErr := content.Seek(0, io.SeekStart)
+		if seekErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to rewind: %w", seekErr))
+		}
+
+		if jh.retry.backoff != nil {
+			waitErr := jh.sleep(jh.retry.backoff(retried))
+			if waitErr != nil {
+				return errors.Join(err, waitErr)
+			}
+		}
+
+		err = jh.call(content, header, jh.deps)
+	}
+
+	return err
+}
+
+// sleep waits for d, or until the context of the parsing is done.
+func (jh judgeHook) sleep(d time.Duration) error {
+	if d <= 0 {
+		return jh.ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-jh.ctx.Done():
+		return jh.ctx.Err()
+	}
 }
 
 func (jh judgeHook) Requirements() []string {
 	return jh.requireParts
 }
 
+func (jh judgeHook) Requirement() conditionjudge.Requirement[string] {
+	return jh.requirement
+}
+
 type customReadCloser struct {
-	io.Reader
+	*io.SectionReader
 	closeFunc func() error
 }
 
 func (cc customReadCloser) Close() error {
 	return cc.closeFunc()
 }
+
+type sectionReadCloser struct {
+	*io.SectionReader
+}
+
+func (sectionReadCloser) Close() error {
+	return nil
+}
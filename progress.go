@@ -0,0 +1,101 @@
+package formstream
+
+import (
+	"io"
+	"time"
+)
+
+// Progress is the progress of parsing the body.
+type Progress struct {
+	// BytesRead the bytes of the body read so far, before decoding.
+	BytesRead int64
+	// ContentLength the size of the body set by WithContentLength. -1 if unknown.
+	ContentLength int64
+	// PartName the name of the part being read. "" before the first part.
+	PartName string
+}
+
+// ProgressFunc receives the progress of parsing.
+type ProgressFunc func(progress Progress)
+
+// WithProgress calls fn with the progress while parsing, at most once per interval,
+// and once more when the parsing finishes.
+func WithProgress(fn ProgressFunc, interval time.Duration) ParserOption {
+	return func(c *parserConfig) {
+		c.progressFunc = fn
+		c.progressInterval = interval
+	}
+}
+
+// WithContentLength sets the size of the body reported as Progress.ContentLength.
+// The web framework integrations set it from the request.
+func WithContentLength(contentLength int64) ParserOption {
+	return func(c *parserConfig) {
+		c.contentLength = contentLength
+	}
+}
+
+// progressReader reports the bytes read from r.
+type progressReader struct {
+	r        io.Reader
+	fn       ProgressFunc
+	interval time.Duration
+	last     time.Time
+	progress Progress
+	reported bool
+}
+
+func (p *Parser) newProgressReader(r io.Reader) *progressReader {
+	return &progressReader{
+		r:        r,
+		fn:       p.progressFunc,
+		interval: p.progressInterval,
+		progress: Progress{
+			ContentLength: p.contentLength,
+		},
+	}
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.progress.BytesRead += int64(n)
+
+	if n > 0 {
+		pr.reported = false
+	}
+
+	now := time.Now()
+	if now.Sub(pr.last) >= pr.interval {
+		pr.last = now
+		pr.report()
+	}
+
+	return n, err
+}
+
+func (pr *progressReader) report() {
+	if pr.reported {
+		return
+	}
+	pr.reported = true
+
+	pr.fn(pr.progress)
+}
+
+// finish reports the last progress if it has not been reported.
+func (pr *progressReader) finish() {
+	if pr == nil {
+		return
+	}
+
+	pr.report()
+}
+
+// setPart sets the name of the part being read.
+func (pr *progressReader) setPart(name string) {
+	if pr == nil {
+		return
+	}
+
+	pr.progress.PartName = name
+}
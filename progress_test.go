@@ -0,0 +1,95 @@
+package formstream_test
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mazrean/formstream"
+)
+
+func TestWithProgress(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		interval      time.Duration
+		contentLength bool
+	}{
+		"every read": {
+			interval:      0,
+			contentLength: true,
+		},
+		"throttled": {
+			interval: time.Hour,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sb := &strings.Builder{}
+			err := createSampleForm(sb, 1*formstream.MB, boundary, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := sb.String()
+
+			var progresses []formstream.Progress
+			options := []formstream.ParserOption{
+				formstream.WithProgress(func(progress formstream.Progress) {
+					progresses = append(progresses, progress)
+				}, tt.interval),
+			}
+			expectedContentLength := int64(-1)
+			if tt.contentLength {
+				expectedContentLength = int64(len(body))
+				options = append(options, formstream.WithContentLength(expectedContentLength))
+			}
+			parser := formstream.NewParser(boundary, options...)
+
+			err = parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+				_, err := io.Copy(io.Discard, r)
+				return err
+			}, formstream.WithRequiredPart("field"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(progresses) == 0 {
+				t.Fatal("progress is not reported")
+			}
+			if !tt.contentLength && len(progresses) != 2 {
+				t.Errorf("progress is not throttled: %d reports", len(progresses))
+			}
+
+			last := progresses[len(progresses)-1]
+			if last.BytesRead != int64(len(body)) {
+				t.Errorf("unexpected bytes read: %d, expected %d", last.BytesRead, len(body))
+			}
+
+			var partNames []string
+			for i, progress := range progresses {
+				if progress.ContentLength != expectedContentLength {
+					t.Errorf("unexpected content length: %d", progress.ContentLength)
+				}
+				if i > 0 && progress.BytesRead < progresses[i-1].BytesRead {
+					t.Errorf("bytes read decreased: %d -> %d", progresses[i-1].BytesRead, progress.BytesRead)
+				}
+				if !slices.Contains(partNames, progress.PartName) {
+					partNames = append(partNames, progress.PartName)
+				}
+			}
+			if tt.contentLength && !slices.Contains(partNames, "stream") {
+				t.Errorf("part name is not reported: %v", partNames)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package formstream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the bytes read per second with a token bucket.
+// It can be shared by parsers to limit their total bandwidth, e.g. per tenant.
+type RateLimiter struct {
+	locker sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns the RateLimiter allowing bytesPerSec bytes per second on average,
+// and bursts of up to burst bytes.
+// It panics if bytesPerSec or burst is not positive.
+func NewRateLimiter(bytesPerSec, burst int) *RateLimiter {
+	checkRateLimit(bytesPerSec, burst)
+
+	return &RateLimiter{
+		rate:   float64(bytesPerSec),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// checkRateLimit panics if the rate limit is not positive, which would disable the limit silently.
+func checkRateLimit(bytesPerSec, burst int) {
+	if bytesPerSec <= 0 || burst <= 0 {
+		panic(fmt.Sprintf("formstream: non-positive rate limit: %d bytes/sec, burst %d bytes", bytesPerSec, burst))
+	}
+}
+
+// take consumes n tokens, and returns the time to wait until the tokens are refilled.
+func (l *RateLimiter) take(n int) time.Duration {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.burst)
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait consumes n tokens, and waits until the tokens are refilled or ctx is done.
+func (l *RateLimiter) wait(ctx context.Context, n int) error {
+	d := l.take(n)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WithReadRateLimit limits the speed of reading the body to bytesPerSec bytes per second,
+// with bursts of up to burst bytes.
+// Each Parse has its own limit; use WithRateLimiter to share a limit between parsers.
+// It panics if bytesPerSec or burst is not positive.
+func WithReadRateLimit(bytesPerSec, burst int) ParserOption {
+	checkRateLimit(bytesPerSec, burst)
+
+	return func(c *parserConfig) {
+		c.rateLimit = &rateLimitConfig{
+			bytesPerSec: bytesPerSec,
+			burst:       burst,
+		}
+	}
+}
+
+// WithRateLimiter limits the speed of reading the body with l.
+func WithRateLimiter(l *RateLimiter) ParserOption {
+	return func(c *parserConfig) {
+		c.rateLimiter = l
+	}
+}
+
+// WithHookRateLimit limits the speed of the stream hook reading the part to bytesPerSec bytes per second,
+// with bursts of up to burst bytes.
+// The reader passed to the hook does not implement the optional interfaces (e.g. FileReader, io.ReaderAt).
+// It panics if bytesPerSec or burst is not positive.
+func WithHookRateLimit(bytesPerSec, burst int) RegisterOption {
+	checkRateLimit(bytesPerSec, burst)
+
+	return func(c *registerConfig) {
+		c.rateLimit = &rateLimitConfig{
+			bytesPerSec: bytesPerSec,
+			burst:       burst,
+		}
+	}
+}
+
+type rateLimitConfig struct {
+	bytesPerSec int
+	burst       int
+}
+
+func (c *rateLimitConfig) newRateLimiter() *RateLimiter {
+	if c == nil {
+		return nil
+	}
+
+	return NewRateLimiter(c.bytesPerSec, c.burst)
+}
+
+// rateLimitedReader reads from r within the limit of l.
+type rateLimitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *RateLimiter
+}
+
+func (rr *rateLimitedReader) Read(p []byte) (int, error) {
+	// bound the wait of a read by the burst
+	if burst := int(rr.l.burst); len(p) > burst && burst > 0 {
+		p = p[:burst]
+	}
+
+	n, err := rr.r.Read(p)
+	if n > 0 {
+		waitErr := rr.l.wait(rr.ctx, n)
+		if waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
+
+// contextReader fails reading from r after ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	err := cr.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	return cr.r.Read(p)
+}
@@ -0,0 +1,136 @@
+package formstream_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mazrean/formstream"
+)
+
+func TestWithReadRateLimit(t *testing.T) {
+	t.Parallel()
+
+	sb := &strings.Builder{}
+	mw := multipart.NewWriter(sb)
+	err := mw.SetBoundary(boundary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mw.WriteField("stream", strings.Repeat("a", 20*int(formstream.KB)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		parserOptions   []formstream.ParserOption
+		registerOptions []formstream.RegisterOption
+		timeout         time.Duration
+		minDuration     time.Duration
+		err             error
+	}{
+		"no limit": {},
+		"read limit": {
+			parserOptions: []formstream.ParserOption{formstream.WithReadRateLimit(100*int(formstream.KB), int(formstream.KB))},
+			minDuration:   150 * time.Millisecond,
+		},
+		"shared limiter": {
+			parserOptions: []formstream.ParserOption{formstream.WithRateLimiter(formstream.NewRateLimiter(100*int(formstream.KB), int(formstream.KB)))},
+			minDuration:   150 * time.Millisecond,
+		},
+		"hook limit": {
+			registerOptions: []formstream.RegisterOption{formstream.WithHookRateLimit(100*int(formstream.KB), int(formstream.KB))},
+			minDuration:     150 * time.Millisecond,
+		},
+		"canceled": {
+			parserOptions: []formstream.ParserOption{formstream.WithReadRateLimit(1, 1)},
+			timeout:       50 * time.Millisecond,
+			err:           context.DeadlineExceeded,
+		},
+		"canceled(hook)": {
+			registerOptions: []formstream.RegisterOption{formstream.WithHookRateLimit(1, 1)},
+			timeout:         50 * time.Millisecond,
+			err:             context.DeadlineExceeded,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			parser := formstream.NewParser(boundary, tt.parserOptions...)
+			err := parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+				_, err := io.Copy(io.Discard, r)
+				return err
+			}, tt.registerOptions...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			err = parser.ParseContext(ctx, strings.NewReader(sb.String()))
+			elapsed := time.Since(start)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if elapsed < tt.minDuration {
+				t.Errorf("parsing is not limited: %s", elapsed)
+			}
+			if tt.timeout > 0 && elapsed > tt.timeout+time.Second {
+				t.Errorf("parsing is not canceled: %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestRateLimit_invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		bytesPerSec int
+		burst       int
+	}{
+		"zero rate":      {bytesPerSec: 0, burst: 1},
+		"negative rate":  {bytesPerSec: -1, burst: 1},
+		"zero burst":     {bytesPerSec: 1, burst: 0},
+		"negative burst": {bytesPerSec: 1, burst: -1},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			for fnName, fn := range map[string]func(){
+				"NewRateLimiter":    func() { formstream.NewRateLimiter(tt.bytesPerSec, tt.burst) },
+				"WithReadRateLimit": func() { formstream.WithReadRateLimit(tt.bytesPerSec, tt.burst) },
+				"WithHookRateLimit": func() { formstream.WithHookRateLimit(tt.bytesPerSec, tt.burst) },
+			} {
+				func() {
+					defer func() {
+						if recover() == nil {
+							t.Errorf("%s: expected panic", fnName)
+						}
+					}()
+
+					fn()
+				}()
+			}
+		})
+	}
+}
@@ -1,11 +1,38 @@
 package formstream
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	conditionjudge "github.com/mazrean/formstream/internal/condition_judge"
 )
 
 // Register registers a stream hook with the given name.
 func (p *Parser) Register(name string, fn StreamHookFunc, options ...RegisterOption) error {
+	return p.RegisterWithDependencies(name, func(r io.Reader, header Header, _ Dependencies) error {
+		return fn(r, header)
+	}, options...)
+}
+
+// RegisterWithDependencies registers a stream hook with the given name.
+// The hook receives the values of the parts required by WithRequiredPart,
+// so it does not need to refer to the Parser.
+func (p *Parser) RegisterWithDependencies(name string, fn StreamHookWithDependenciesFunc, options ...RegisterOption) error {
+	return p.register(name, func(r io.Reader, header Header, deps Dependencies) (any, error) {
+		return nil, fn(r, header, deps)
+	}, false, options)
+}
+
+// RegisterWithResult registers a stream hook that publishes a result with the given name.
+// The hooks registered with WithRequiredResult(name) can read the result through Dependencies.Result.
+func (p *Parser) RegisterWithResult(name string, fn StreamHookWithResultFunc, options ...RegisterOption) error {
+	return p.register(name, fn, true, options)
+}
+
+func (p *Parser) register(name string, fn StreamHookWithResultFunc, hasResult bool, options []RegisterOption) error {
 	if _, ok := p.hookMap[name]; ok {
 		return DuplicateHookNameError{Name: name}
 	}
@@ -15,14 +42,50 @@ func (p *Parser) Register(name string, fn StreamHookFunc, options ...RegisterOpt
 		opt(c)
 	}
 
-	p.hookMap[name] = streamHook{
+	if len(c.filters) > 0 {
+		fn = filterHook(fn, c.filters)
+	}
+
+	hook := streamHook{
 		fn:           fn,
+		hasResult:    hasResult,
 		requireParts: c.requireParts,
+		retry:        c.retry,
+		spool:        c.spool,
+		headerCheck:  c.headerCheck,
+		requirements: c.requirements,
+		forceSpool:   c.forceSpool,
+		rateLimit:    c.rateLimit,
 	}
 
+	err := p.detectResultCycle(name, hook)
+	if err != nil {
+		return err
+	}
+
+	p.hookMap[name] = hook
+
 	return nil
 }
 
+// detectResultCycle returns DependencyCycleError if the hook and the registered hooks wait for the results of each other.
+func (p *Parser) detectResultCycle(name string, hook streamHook) error {
+	graph := make(map[string][]string, len(p.hookMap)+1)
+	for hookName, h := range p.hookMap {
+		graph[hookName] = mandatoryRequirementResults(h.requirements)
+	}
+	graph[name] = mandatoryRequirementResults(hook.requirements)
+
+	err := conditionjudge.DetectCycle(graph)
+
+	var cycleErr *conditionjudge.CycleError[string]
+	if errors.As(err, &cycleErr) {
+		return DependencyCycleError{Hooks: cycleErr.Cycle}
+	}
+
+	return err
+}
+
 type DuplicateHookNameError struct {
 	Name string
 }
@@ -31,8 +94,52 @@ func (e DuplicateHookNameError) Error() string {
 	return fmt.Sprintf("duplicate hook name: %s", e.Name)
 }
 
+// DependencyCycleError is returned when stream hooks wait for the results of each other.
+type DependencyCycleError struct {
+	// Hooks the hooks in the cycle. Each hook waits for the result of the next one, and the last one waits for the first one.
+	Hooks []string
+}
+
+func (e DependencyCycleError) Error() string {
+	if len(e.Hooks) == 0 {
+		return "dependency cycle"
+	}
+
+	return fmt.Sprintf("dependency cycle: %s -> %s", strings.Join(e.Hooks, " -> "), e.Hooks[0])
+}
+
 type registerConfig struct {
 	requireParts []string
+	retry        retryConfig
+	spool        spoolConfig
+	headerCheck  HeaderCheckFunc
+	requirements []Requirement
+	filters      []readerFilter
+	forceSpool   bool
+	rateLimit    *rateLimitConfig
+}
+
+// readerFilter checks or transforms the content of the part before the stream hook reads it.
+type readerFilter func(r io.Reader, header Header) (io.Reader, error)
+
+// filterHook applies the filters in order before fn.
+func filterHook(fn StreamHookWithResultFunc, filters []readerFilter) StreamHookWithResultFunc {
+	return func(r io.Reader, header Header, deps Dependencies) (any, error) {
+		for _, filter := range filters {
+			var err error
+			r, err = filter(r, header)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return fn(r, header, deps)
+	}
+}
+
+type retryConfig struct {
+	maxRetries uint
+	backoff    BackoffFunc
 }
 
 type RegisterOption func(*registerConfig)
@@ -43,3 +150,97 @@ func WithRequiredPart(name string) RegisterOption {
 		c.requireParts = append(c.requireParts, name)
 	}
 }
+
+// WithRequirement adds req to the requirements of the stream hook.
+// The stream hook runs when all of the requirements added by WithRequiredPart and WithRequirement are met.
+func WithRequirement(req Requirement) RegisterOption {
+	return func(c *registerConfig) {
+		c.requirements = append(c.requirements, req)
+	}
+}
+
+// WithRequiredResult requires the result of the stream hook named name.
+// The hook runs after the hook named name succeeds, and can read its result through Dependencies.Result.
+func WithRequiredResult(name string) RegisterOption {
+	return WithRequirement(HookResult(name))
+}
+
+// WithRequiredAnyPart requires at least one of the parts for the stream hook.
+func WithRequiredAnyPart(names ...string) RegisterOption {
+	reqs := make([]Requirement, 0, len(names))
+	for _, name := range names {
+		reqs = append(reqs, Part(name))
+	}
+
+	return WithRequirement(AnyOf(reqs...))
+}
+
+// WithRequiredPartIf requires the part named name only when pred returns true for the first value of the part named key.
+// The part named key is always required.
+func WithRequiredPartIf(name string, key string, pred func(value string, header Header) bool) RegisterOption {
+	return WithRequirement(If(key, pred, Part(name)))
+}
+
+// BackoffFunc returns the duration to wait before the given retry attempt.
+// attempt starts from 1.
+type BackoffFunc func(attempt uint) time.Duration
+
+// ConstantBackoff waits the same duration before every retry.
+func ConstantBackoff(d time.Duration) BackoffFunc {
+	return func(uint) time.Duration {
+		return d
+	}
+}
+
+// ExponentialBackoff doubles the duration before every retry, starting from base.
+func ExponentialBackoff(base time.Duration) BackoffFunc {
+	return func(attempt uint) time.Duration {
+		// avoid overflow
+		attempt = min(attempt, 32)
+
+		return base << (attempt - 1)
+	}
+}
+
+// WithRetry re-runs the stream hook up to maxRetries times when it returns an error.
+// The reader passed to the hook is rewound to the start of the part before every retry.
+// Only the hooks run on the buffered data (when the required parts arrive after the part) can be retried,
+// because the part has already been consumed from the request on the streaming path.
+// Use WithSpooling to retry the hooks on the streaming path too.
+// On the buffered path, the reader also implements io.Seeker and io.ReaderAt.
+// backoff may be nil to retry immediately.
+func WithRetry(maxRetries uint, backoff BackoffFunc) RegisterOption {
+	return func(c *registerConfig) {
+		c.retry = retryConfig{
+			maxRetries: maxRetries,
+			backoff:    backoff,
+		}
+	}
+}
+
+type spoolConfig struct {
+	enabled     bool
+	maxDiskSize DataSize
+}
+
+// WithSpooling copies the part to memory or a temp file while the stream hook reads it on the streaming path,
+// so that the hook can be retried with WithRetry from the spooled copy.
+// The spooled copy uses up to the memory limits of the parser (WithMaxMemFileSize, WithMaxMemSize) and maxDiskSize of disk.
+// If the part is larger than that, the hook is not retried.
+func WithSpooling(maxDiskSize DataSize) RegisterOption {
+	return func(c *registerConfig) {
+		c.spool = spoolConfig{
+			enabled:     true,
+			maxDiskSize: maxDiskSize,
+		}
+	}
+}
+
+// WithForceSpool buffers the part on memory or a temp file before the stream hook runs, even if the requirements are already met.
+// The reader passed to the hook then implements io.ReaderAt and io.Seeker, which formats needing random access (e.g. zip) require.
+// The part is buffered even with WithStrictOrder.
+func WithForceSpool() RegisterOption {
+	return func(c *registerConfig) {
+		c.forceSpool = true
+	}
+}
@@ -0,0 +1,141 @@
+package formstream
+
+import (
+	conditionjudge "github.com/mazrean/formstream/internal/condition_judge"
+)
+
+// Requirement is a condition on the arrived parts to run a stream hook.
+type Requirement struct {
+	// names, results the parts and the hooks referred by the requirement
+	names   []string
+	results []string
+	// mandatoryNames, mandatoryResults the parts and the hooks that must be satisfied to meet the requirement
+	mandatoryNames   []string
+	mandatoryResults []string
+	build            func(valueMap map[string][]Value) conditionjudge.Requirement[string]
+}
+
+// Part requires the part to arrive.
+func Part(name string) Requirement {
+	return Requirement{
+		names:          []string{name},
+		mandatoryNames: []string{name},
+		build: func(map[string][]Value) conditionjudge.Requirement[string] {
+			return conditionjudge.Key(name)
+		},
+	}
+}
+
+// HookResult requires the stream hook named name to succeed.
+// The hook must be registered with RegisterWithResult to publish a result, but any hook can be required.
+func HookResult(name string) Requirement {
+	return Requirement{
+		results:          []string{name},
+		mandatoryResults: []string{name},
+		build: func(map[string][]Value) conditionjudge.Requirement[string] {
+			return conditionjudge.Done(name)
+		},
+	}
+}
+
+// AllOf requires all of reqs.
+func AllOf(reqs ...Requirement) Requirement {
+	var mandatoryNames, mandatoryResults []string
+	for _, req := range reqs {
+		mandatoryNames = append(mandatoryNames, req.mandatoryNames...)
+		mandatoryResults = append(mandatoryResults, req.mandatoryResults...)
+	}
+
+	return Requirement{
+		names:            requirementNames(reqs),
+		results:          requirementResults(reqs),
+		mandatoryNames:   mandatoryNames,
+		mandatoryResults: mandatoryResults,
+		build: func(valueMap map[string][]Value) conditionjudge.Requirement[string] {
+			return conditionjudge.All(buildRequirements(reqs, valueMap)...)
+		},
+	}
+}
+
+// AnyOf requires at least one of reqs.
+func AnyOf(reqs ...Requirement) Requirement {
+	return Requirement{
+		names:   requirementNames(reqs),
+		results: requirementResults(reqs),
+		build: func(valueMap map[string][]Value) conditionjudge.Requirement[string] {
+			return conditionjudge.Any(buildRequirements(reqs, valueMap)...)
+		},
+	}
+}
+
+// If requires then only when pred returns true for the first value of the part named key.
+// The part named key is always required.
+// If the part has no value (e.g. it is handled by a stream hook), then is not required.
+func If(key string, pred func(value string, header Header) bool, then Requirement) Requirement {
+	return Requirement{
+		names:          append([]string{key}, then.names...),
+		results:        then.results,
+		mandatoryNames: []string{key},
+		build: func(valueMap map[string][]Value) conditionjudge.Requirement[string] {
+			return conditionjudge.All(
+				conditionjudge.Key(key),
+				conditionjudge.Any(
+					conditionjudge.Predicate[string](func() bool {
+						values := valueMap[key]
+						if len(values) == 0 {
+							return true
+						}
+
+						return !pred(values[0].Unwrap())
+					}),
+					then.build(valueMap),
+				),
+			)
+		},
+	}
+}
+
+func requirementNames(reqs []Requirement) []string {
+	var names []string
+	for _, req := range reqs {
+		names = append(names, req.names...)
+	}
+
+	return names
+}
+
+func mandatoryRequirementResults(reqs []Requirement) []string {
+	var results []string
+	for _, req := range reqs {
+		results = append(results, req.mandatoryResults...)
+	}
+
+	return results
+}
+
+func mandatoryRequirementNames(reqs []Requirement) []string {
+	var names []string
+	for _, req := range reqs {
+		names = append(names, req.mandatoryNames...)
+	}
+
+	return names
+}
+
+func requirementResults(reqs []Requirement) []string {
+	var results []string
+	for _, req := range reqs {
+		results = append(results, req.results...)
+	}
+
+	return results
+}
+
+func buildRequirements(reqs []Requirement, valueMap map[string][]Value) []conditionjudge.Requirement[string] {
+	judgeReqs := make([]conditionjudge.Requirement[string], 0, len(reqs))
+	for _, req := range reqs {
+		judgeReqs = append(judgeReqs, req.build(valueMap))
+	}
+
+	return judgeReqs
+}
@@ -0,0 +1,234 @@
+// Package resumable implements resumable uploads split into chunks sent in multiple multipart requests.
+//
+// Each request carries the upload id, the offset of the chunk and the total size of the upload in form fields,
+// followed by the chunk. The chunks are appended to a session in a Store, and the completion hook runs once
+// with the assembled data after the last chunk.
+package resumable
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/mazrean/formstream"
+)
+
+// ErrInvalidField is returned when the upload id, the offset or the total size in the form is invalid.
+var ErrInvalidField = errors.New("invalid field")
+
+// Status is the state of the upload after a chunk.
+// It is published as the result of the chunk hook, so it can be read with formstream.Parser.Result.
+type Status struct {
+	ID        string
+	Offset    int64
+	TotalSize int64
+	// Completed the upload is completed and the completion hook has run.
+	Completed bool
+}
+
+type config struct {
+	idField        string
+	offsetField    string
+	totalSizeField string
+	maxTotalSize   formstream.DataSize
+}
+
+type Option func(*config)
+
+// WithFieldNames sets the names of the form fields carrying the upload id, the offset and the total size.
+// default: "upload_id", "offset", "total_size"
+func WithFieldNames(id, offset, totalSize string) Option {
+	return func(c *config) {
+		c.idField = id
+		c.offsetField = offset
+		c.totalSizeField = totalSize
+	}
+}
+
+// WithMaxTotalSize sets the maximum total size of an upload.
+// default: no limit
+func WithMaxTotalSize(maxTotalSize formstream.DataSize) Option {
+	return func(c *config) {
+		c.maxTotalSize = maxTotalSize
+	}
+}
+
+// Uploader appends the chunks to the sessions in a Store.
+type Uploader struct {
+	store      Store
+	onComplete formstream.StreamHookFunc
+	config
+}
+
+// NewUploader returns the Uploader storing the chunks in store.
+// onComplete runs once per upload with the reader over the assembled data and the header of the last chunk (see Complete).
+// The session is removed after onComplete succeeds. If onComplete fails, the session is kept,
+// and the completion is retried by sending an empty chunk at the end of the upload.
+func NewUploader(store Store, onComplete formstream.StreamHookFunc, options ...Option) *Uploader {
+	c := config{
+		idField:        "upload_id",
+		offsetField:    "offset",
+		totalSizeField: "total_size",
+	}
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	return &Uploader{
+		store:      store,
+		onComplete: onComplete,
+		config:     c,
+	}
+}
+
+// Register registers the hook receiving the chunk in the part named name to parser.
+// The hook publishes the Status of the upload as its result.
+// The errors of the client (e.g. ErrOffsetMismatch) are wrapped in formstream.StatusError
+// with the status code to respond with, e.g. 409 Conflict.
+func (u *Uploader) Register(parser *formstream.Parser, name string, options ...formstream.RegisterOption) error {
+	options = append([]formstream.RegisterOption{
+		formstream.WithRequiredPart(u.idField),
+		formstream.WithRequiredPart(u.offsetField),
+		formstream.WithRequiredPart(u.totalSizeField),
+	}, options...)
+
+	return parser.RegisterWithResult(name, func(r io.Reader, header formstream.Header, deps formstream.Dependencies) (any, error) {
+		return u.appendChunk(r, header, deps)
+	}, options...)
+}
+
+// clientError wraps the errors of the client in formstream.StatusError,
+// so that they are not responded with 500 as the errors of the hook.
+func clientError(err error) error {
+	var status int
+	switch {
+	case errors.Is(err, ErrInvalidField), errors.Is(err, ErrInvalidID):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrSessionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrOffsetMismatch):
+		status = http.StatusConflict
+	case errors.Is(err, ErrTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	default:
+		return err
+	}
+
+	return formstream.StatusError{Status: status, Err: err}
+}
+
+func (u *Uploader) appendChunk(r io.Reader, header formstream.Header, deps formstream.Dependencies) (Status, error) {
+	id, _, _ := deps.Value(u.idField)
+	err := ValidateID(id)
+	if err != nil {
+		return Status{}, clientError(fmt.Errorf("%w(%s): %w", ErrInvalidField, u.idField, err))
+	}
+
+	offset, err := u.intField(deps, u.offsetField)
+	if err != nil {
+		return Status{}, clientError(err)
+	}
+	totalSize, err := u.intField(deps, u.totalSizeField)
+	if err != nil {
+		return Status{}, clientError(err)
+	}
+
+	if u.maxTotalSize > 0 && formstream.DataSize(totalSize) > u.maxTotalSize {
+		return Status{}, clientError(ErrTooLarge)
+	}
+
+	session, err := u.session(id, offset, totalSize)
+	if err != nil {
+		return Status{}, clientError(err)
+	}
+
+	newOffset, err := session.Append(offset, r)
+	status := Status{
+		ID:        id,
+		Offset:    newOffset,
+		TotalSize: totalSize,
+	}
+	if err != nil {
+		return status, clientError(fmt.Errorf("failed to append chunk: %w", err))
+	}
+
+	if newOffset < totalSize {
+		return status, nil
+	}
+
+	err = Complete(u.store, session, header, u.onComplete)
+	if errors.Is(err, ErrCompleting) {
+		// the errors of onComplete are of the hook, but the concurrent completion is of the client
+		return status, formstream.StatusError{Status: http.StatusLocked, Err: err}
+	}
+	if err != nil {
+		return status, err
+	}
+	status.Completed = true
+
+	return status, nil
+}
+
+// session returns the session of id, creating it for the first chunk.
+func (u *Uploader) session(id string, offset, totalSize int64) (Session, error) {
+	session, err := u.store.Get(id)
+	if errors.Is(err, ErrSessionNotFound) && offset == 0 {
+		session, err = u.store.Create(id, totalSize)
+		if errors.Is(err, ErrSessionExists) {
+			// created by a concurrent request
+			session, err = u.store.Get(id)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if session.TotalSize() != totalSize {
+		return nil, fmt.Errorf("%w(%s): expected %d, got %d", ErrInvalidField, u.totalSizeField, session.TotalSize(), totalSize)
+	}
+
+	return session, nil
+}
+
+// Complete runs onComplete with the data of session, which has received all its data, and removes the session.
+// The completion is claimed with Store.Claim, so onComplete runs once even if concurrent requests complete the session;
+// the others fail with ErrCompleting.
+// If onComplete fails, the session is kept and the claim is released, so that the completion can be retried.
+func Complete(store Store, session Session, header formstream.Header, onComplete formstream.StreamHookFunc) error {
+	release, err := store.Claim(session.ID())
+	if err != nil {
+		return fmt.Errorf("failed to claim completion: %w", err)
+	}
+
+	r, err := session.Reader()
+	if err != nil {
+		release()
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+
+	hookErr := onComplete(r, header)
+	closeErr := r.Close()
+	if hookErr != nil {
+		release()
+		return errors.Join(hookErr, closeErr)
+	}
+
+	removeErr := store.Remove(session.ID())
+	if removeErr != nil {
+		release()
+	}
+
+	return errors.Join(closeErr, removeErr)
+}
+
+func (u *Uploader) intField(deps formstream.Dependencies, name string) (int64, error) {
+	value, _, _ := deps.Value(name)
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w(%s): %q", ErrInvalidField, name, value)
+	}
+
+	return n, nil
+}
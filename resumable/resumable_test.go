@@ -0,0 +1,316 @@
+package resumable_test
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mazrean/formstream"
+	httpform "github.com/mazrean/formstream/http"
+	"github.com/mazrean/formstream/resumable"
+)
+
+const boundary = "boundary"
+
+func createChunkForm(t *testing.T, id string, offset, totalSize int, chunk string) string {
+	t.Helper()
+
+	sb := &strings.Builder{}
+	mw := multipart.NewWriter(sb)
+	err := mw.SetBoundary(boundary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range [][2]string{
+		{"upload_id", id},
+		{"offset", strconv.Itoa(offset)},
+		{"total_size", strconv.Itoa(totalSize)},
+	} {
+		err = mw.WriteField(field[0], field[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fw, err := mw.CreateFormFile("chunk", "video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fw.Write([]byte(chunk))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sb.String()
+}
+
+func TestUploader(t *testing.T) {
+	t.Parallel()
+
+	store, err := resumable.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var completed []string
+	uploader := resumable.NewUploader(store, func(r io.Reader, header formstream.Header) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		completed = append(completed, header.FileName()+":"+string(data))
+
+		return nil
+	}, resumable.WithMaxTotalSize(100))
+
+	steps := []struct {
+		id        string
+		offset    int
+		totalSize int
+		chunk     string
+		expected  resumable.Status
+		err       error
+	}{
+		{
+			id: "upload", offset: 0, totalSize: 9, chunk: "aaa",
+			expected: resumable.Status{ID: "upload", Offset: 3, TotalSize: 9},
+		},
+		{
+			id: "upload", offset: 6, totalSize: 9, chunk: "ccc",
+			err: resumable.ErrOffsetMismatch,
+		},
+		{
+			id: "upload", offset: 3, totalSize: 10, chunk: "bbb",
+			err: resumable.ErrInvalidField,
+		},
+		{
+			id: "upload", offset: 3, totalSize: 9, chunk: "bbb",
+			expected: resumable.Status{ID: "upload", Offset: 6, TotalSize: 9},
+		},
+		{
+			id: "upload", offset: 6, totalSize: 9, chunk: "ccc",
+			expected: resumable.Status{ID: "upload", Offset: 9, TotalSize: 9, Completed: true},
+		},
+		{
+			id: "upload", offset: 6, totalSize: 9, chunk: "ccc",
+			err: resumable.ErrSessionNotFound,
+		},
+		{
+			id: "other", offset: 3, totalSize: 9, chunk: "aaa",
+			err: resumable.ErrSessionNotFound,
+		},
+		{
+			id: "../other", offset: 0, totalSize: 9, chunk: "aaa",
+			err: resumable.ErrInvalidID,
+		},
+		{
+			id: "large", offset: 0, totalSize: 101, chunk: "aaa",
+			err: resumable.ErrTooLarge,
+		},
+	}
+
+	for i, step := range steps {
+		parser := formstream.NewParser(boundary)
+		err := uploader.Register(parser, "chunk")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = parser.Parse(strings.NewReader(createChunkForm(t, step.id, step.offset, step.totalSize, step.chunk)))
+		if !errors.Is(err, step.err) {
+			t.Fatalf("step %d: unexpected error: %v", i, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		result, ok := parser.Result("chunk")
+		if !ok {
+			t.Fatalf("step %d: result not found", i)
+		}
+		if status := result.(resumable.Status); status != step.expected {
+			t.Errorf("step %d: unexpected status: %+v", i, status)
+		}
+	}
+
+	if len(completed) != 1 || completed[0] != "video.mp4:aaabbbccc" {
+		t.Errorf("unexpected completed uploads: %v", completed)
+	}
+}
+
+func TestUploader_completeOnce(t *testing.T) {
+	t.Parallel()
+
+	store, err := resumable.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errHook := errors.New("hook error")
+
+	calls := 0
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	uploader := resumable.NewUploader(store, func(r io.Reader, _ formstream.Header) error {
+		calls++
+		if calls == 1 {
+			return errHook
+		}
+
+		close(started)
+		<-finish
+
+		_, err := io.Copy(io.Discard, r)
+		return err
+	})
+
+	parse := func(offset int, chunk string) error {
+		parser := formstream.NewParser(boundary)
+		err := uploader.Register(parser, "chunk")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return parser.Parse(strings.NewReader(createChunkForm(t, "upload", offset, 3, chunk)))
+	}
+
+	// the session is kept when the completion hook fails
+	err = parse(0, "aaa")
+	if !errors.Is(err, errHook) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// an empty chunk at the end retries the completion
+	done := make(chan error, 1)
+	go func() {
+		done <- parse(3, "")
+	}()
+	<-started
+
+	// the completion runs only once
+	err = parse(3, "")
+	if !errors.Is(err, resumable.ErrCompleting) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	close(finish)
+	err = <-done
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("unexpected calls: %d", calls)
+	}
+
+	_, err = store.Get("upload")
+	if !errors.Is(err, resumable.ErrSessionNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestUploader_status(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		id             string
+		offset         int
+		totalSize      int
+		chunk          string
+		expectedStatus int
+	}{
+		"invalid id": {
+			id:             "../upload",
+			totalSize:      3,
+			chunk:          "aaa",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid total size": {
+			id:             "upload",
+			totalSize:      -1,
+			chunk:          "aaa",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"session not found": {
+			id:             "missing",
+			offset:         1,
+			totalSize:      3,
+			chunk:          "aa",
+			expectedStatus: http.StatusNotFound,
+		},
+		"offset mismatch": {
+			id:             "upload",
+			offset:         2,
+			totalSize:      3,
+			chunk:          "a",
+			expectedStatus: http.StatusConflict,
+		},
+		"too large": {
+			id:             "upload",
+			offset:         1,
+			totalSize:      3,
+			chunk:          "aaa",
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		"total size over the limit": {
+			id:             "large",
+			totalSize:      100,
+			chunk:          "aaa",
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			store, err := resumable.NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			uploader := resumable.NewUploader(store, func(r io.Reader, _ formstream.Header) error {
+				_, err := io.Copy(io.Discard, r)
+				return err
+			}, resumable.WithMaxTotalSize(10))
+
+			parse := func(id string, offset, totalSize int, chunk string) error {
+				parser := formstream.NewParser(boundary)
+				err := uploader.Register(parser, "chunk")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return parser.Parse(strings.NewReader(createChunkForm(t, id, offset, totalSize, chunk)))
+			}
+
+			err = parse("upload", 0, 3, "a")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err = parse(tt.id, tt.offset, tt.totalSize, tt.chunk)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+
+			rec := httptest.NewRecorder()
+			httpform.WriteError(rec, err)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("unexpected status code: expected %d, actual %d(%s)", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
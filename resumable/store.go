@@ -0,0 +1,438 @@
+package resumable
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrSessionNotFound is returned when the session of the upload id does not exist.
+	ErrSessionNotFound = errors.New("upload session not found")
+	// ErrSessionExists is returned when a session is created with the upload id of an existing session.
+	ErrSessionExists = errors.New("upload session already exists")
+	// ErrInvalidID is returned when the upload id is not valid (see ValidateID).
+	ErrInvalidID = errors.New("invalid upload id")
+	// ErrOffsetMismatch is returned when a chunk does not start at the current offset of the session,
+	// e.g. it arrives out of order or is sent twice.
+	ErrOffsetMismatch = errors.New("offset mismatch")
+	// ErrTooLarge is returned when the data exceeds the total size of the session.
+	ErrTooLarge = errors.New("upload too large")
+	// ErrCompleting is returned when the completion of the session is claimed by another request.
+	ErrCompleting = errors.New("upload is being completed")
+)
+
+// Store keeps the upload sessions.
+// The implementations must be safe for concurrent use.
+type Store interface {
+	// Create creates the session of id for totalSize bytes.
+	// It fails with ErrSessionExists if the session exists.
+	Create(id string, totalSize int64) (Session, error)
+	// Get returns the session of id.
+	// It fails with ErrSessionNotFound if the session does not exist.
+	Get(id string) (Session, error)
+	// Remove removes the session of id and its data.
+	// It also ends the claim of the session.
+	Remove(id string) error
+	// Claim claims the completion of the session of id, so that only one request runs the completion hook.
+	// It fails with ErrCompleting if the completion is claimed already, and with ErrSessionNotFound if the session does not exist.
+	// The claim lasts until release is called or the session is removed.
+	Claim(id string) (release func(), err error)
+}
+
+// Session is an upload in progress.
+type Session interface {
+	ID() string
+	TotalSize() int64
+	// Offset returns the size of the data received.
+	Offset() (int64, error)
+	// Append writes the data from r at offset, and returns the new offset.
+	// It fails with ErrOffsetMismatch if offset is not the current offset,
+	// and with ErrTooLarge if the data exceeds the total size, in which case nothing is written.
+	// If reading r fails, the data read until then is kept, so the client can resume from the new offset.
+	Append(offset int64, r io.Reader) (int64, error)
+	// Reader returns the reader over the data received.
+	Reader() (io.ReadCloser, error)
+}
+
+// MetadataStore is a Store keeping metadata of the sessions, e.g. the file name.
+type MetadataStore interface {
+	Store
+	// CreateWithMetadata is Create keeping metadata with the session.
+	CreateWithMetadata(id string, totalSize int64, metadata map[string]string) (Session, error)
+	// Metadata returns the metadata of the session of id.
+	// It fails with ErrSessionNotFound if the session does not exist.
+	Metadata(id string) (map[string]string, error)
+}
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// ValidateID checks that id can be used as an upload id.
+// Upload ids consist of up to 128 ASCII letters, digits, '-' and '_'.
+func ValidateID(id string) error {
+	if !idPattern.MatchString(id) {
+		return fmt.Errorf("%w: %q", ErrInvalidID, id)
+	}
+
+	return nil
+}
+
+// FileStore is the MetadataStore keeping the sessions in a directory.
+// The data of a session is stored in <id>.bin, its total size in <id>.info and its metadata in <id>.meta.
+type FileStore struct {
+	dir    string
+	locker sync.Mutex
+	locks  map[string]*sessionLock
+	// claims the claims of the sessions whose completion is claimed, by id
+	claims map[string]uint64
+	// claimSeq the number of claims made, to identify them
+	claimSeq uint64
+}
+
+type sessionLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewFileStore returns the FileStore in dir, creating dir if it does not exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dir: %w", err)
+	}
+
+	return &FileStore{
+		dir:    dir,
+		locks:  make(map[string]*sessionLock),
+		claims: make(map[string]uint64),
+	}, nil
+}
+
+// lock locks the session of id, and returns the function to unlock it.
+func (s *FileStore) lock(id string) func() {
+	s.locker.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &sessionLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.locker.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		s.locker.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.locker.Unlock()
+	}
+}
+
+func (s *FileStore) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".info")
+}
+
+func (s *FileStore) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+func (s *FileStore) metadataPath(id string) string {
+	return filepath.Join(s.dir, id+".meta")
+}
+
+func (s *FileStore) Create(id string, totalSize int64) (Session, error) {
+	return s.CreateWithMetadata(id, totalSize, nil)
+}
+
+func (s *FileStore) CreateWithMetadata(id string, totalSize int64, metadata map[string]string) (Session, error) {
+	err := ValidateID(id)
+	if err != nil {
+		return nil, err
+	}
+	if totalSize < 0 {
+		return nil, fmt.Errorf("invalid total size: %d", totalSize)
+	}
+
+	unlock := s.lock(id)
+	defer unlock()
+
+	info, err := os.OpenFile(s.infoPath(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionExists, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create info file: %w", err)
+	}
+
+	_, err = info.WriteString(strconv.FormatInt(totalSize, 10))
+	err = errors.Join(err, info.Close())
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to write info file: %w", err), os.Remove(s.infoPath(id)))
+	}
+
+	if len(metadata) > 0 {
+		b, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to encode metadata: %w", err), os.Remove(s.infoPath(id)))
+		}
+
+		err = os.WriteFile(s.metadataPath(id), b, 0o600)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to write metadata file: %w", err), os.Remove(s.infoPath(id)))
+		}
+	}
+
+	data, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create data file: %w", err), os.Remove(s.infoPath(id)))
+	}
+	err = data.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close data file: %w", err)
+	}
+
+	return &fileSession{
+		store:     s,
+		id:        id,
+		totalSize: totalSize,
+	}, nil
+}
+
+func (s *FileStore) Get(id string) (Session, error) {
+	err := ValidateID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := s.lock(id)
+	defer unlock()
+
+	info, err := os.ReadFile(s.infoPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read info file: %w", err)
+	}
+
+	totalSize, err := strconv.ParseInt(strings.TrimSpace(string(info)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse info file: %w", err)
+	}
+
+	return &fileSession{
+		store:     s,
+		id:        id,
+		totalSize: totalSize,
+	}, nil
+}
+
+func (s *FileStore) Metadata(id string) (map[string]string, error) {
+	err := ValidateID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := s.lock(id)
+	defer unlock()
+
+	_, err = os.Stat(s.infoPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get info file info: %w", err)
+	}
+
+	b, err := os.ReadFile(s.metadataPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata file: %w", err)
+	}
+
+	metadata := map[string]string{}
+	err = json.Unmarshal(b, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+
+	return metadata, nil
+}
+
+func (s *FileStore) Remove(id string) error {
+	err := ValidateID(id)
+	if err != nil {
+		return err
+	}
+
+	unlock := s.lock(id)
+	defer unlock()
+
+	s.locker.Lock()
+	delete(s.claims, id)
+	s.locker.Unlock()
+
+	infoErr := os.Remove(s.infoPath(id))
+	if errors.Is(infoErr, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	dataErr := os.Remove(s.dataPath(id))
+	if errors.Is(dataErr, fs.ErrNotExist) {
+		dataErr = nil
+	}
+
+	metadataErr := os.Remove(s.metadataPath(id))
+	if errors.Is(metadataErr, fs.ErrNotExist) {
+		metadataErr = nil
+	}
+
+	return errors.Join(infoErr, dataErr, metadataErr)
+}
+
+// Claim claims the completion of the session of id.
+// The claims are kept in memory, so they are not shared with the FileStores of other processes.
+func (s *FileStore) Claim(id string) (func(), error) {
+	err := ValidateID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := s.lock(id)
+	defer unlock()
+
+	_, err = os.Stat(s.infoPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get info file info: %w", err)
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if _, ok := s.claims[id]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrCompleting, id)
+	}
+	s.claimSeq++
+	claim := s.claimSeq
+	s.claims[id] = claim
+
+	return func() {
+		s.locker.Lock()
+		defer s.locker.Unlock()
+
+		// the session may have been removed and claimed again
+		if s.claims[id] == claim {
+			delete(s.claims, id)
+		}
+	}, nil
+}
+
+type fileSession struct {
+	store     *FileStore
+	id        string
+	totalSize int64
+}
+
+func (sess *fileSession) ID() string {
+	return sess.id
+}
+
+func (sess *fileSession) TotalSize() int64 {
+	return sess.totalSize
+}
+
+func (sess *fileSession) Offset() (int64, error) {
+	unlock := sess.store.lock(sess.id)
+	defer unlock()
+
+	return sess.offset()
+}
+
+func (sess *fileSession) offset() (int64, error) {
+	stat, err := os.Stat(sess.store.dataPath(sess.id))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("%w: %s", ErrSessionNotFound, sess.id)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get data file info: %w", err)
+	}
+
+	return stat.Size(), nil
+}
+
+func (sess *fileSession) Append(offset int64, r io.Reader) (int64, error) {
+	unlock := sess.store.lock(sess.id)
+	defer unlock()
+
+	current, err := sess.offset()
+	if err != nil {
+		return 0, err
+	}
+	if offset != current {
+		return current, fmt.Errorf("%w: expected %d, got %d", ErrOffsetMismatch, current, offset)
+	}
+
+	f, err := os.OpenFile(sess.store.dataPath(sess.id), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return current, fmt.Errorf("failed to open data file: %w", err)
+	}
+	defer f.Close()
+
+	n, copyErr := io.Copy(f, io.LimitReader(r, sess.totalSize-current))
+	if copyErr == nil {
+		// read one more byte to detect the data exceeding the total size
+		var b [1]byte
+		m, err := io.ReadFull(r, b[:])
+		if m > 0 {
+			err = f.Truncate(current)
+			if err != nil {
+				return current + n, fmt.Errorf("failed to truncate data file: %w", err)
+			}
+
+			return current, ErrTooLarge
+		}
+		if !errors.Is(err, io.EOF) {
+			copyErr = err
+		}
+	}
+	if copyErr != nil {
+		return current + n, fmt.Errorf("failed to write data: %w", copyErr)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return current + n, fmt.Errorf("failed to close data file: %w", err)
+	}
+
+	return current + n, nil
+}
+
+func (sess *fileSession) Reader() (io.ReadCloser, error) {
+	f, err := os.Open(sess.store.dataPath(sess.id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sess.id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data file: %w", err)
+	}
+
+	return f, nil
+}
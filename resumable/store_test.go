@@ -0,0 +1,205 @@
+package resumable_test
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/mazrean/formstream/resumable"
+)
+
+func TestFileStore(t *testing.T) {
+	t.Parallel()
+
+	store, err := resumable.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Get("upload")
+	if !errors.Is(err, resumable.ErrSessionNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = store.Create("../upload", 10)
+	if !errors.Is(err, resumable.ErrInvalidID) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	session, err := store.Create("upload", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Create("upload", 10)
+	if !errors.Is(err, resumable.ErrSessionExists) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	steps := []struct {
+		offset   int64
+		data     string
+		expected int64
+		err      error
+	}{
+		{offset: 0, data: "aaaa", expected: 4},
+		{offset: 0, data: "aaaa", expected: 4, err: resumable.ErrOffsetMismatch},
+		{offset: 4, data: "bbbbbbb", expected: 4, err: resumable.ErrTooLarge},
+		{offset: 4, data: "bbbbbb", expected: 10},
+	}
+	for _, step := range steps {
+		offset, err := session.Append(step.offset, strings.NewReader(step.data))
+		if !errors.Is(err, step.err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if offset != step.expected {
+			t.Errorf("unexpected offset: %d", offset)
+		}
+	}
+
+	session, err = store.Get("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.TotalSize() != 10 {
+		t.Errorf("unexpected total size: %d", session.TotalSize())
+	}
+	offset, err := session.Offset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 10 {
+		t.Errorf("unexpected offset: %d", offset)
+	}
+
+	r, err := session.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "aaaabbbbbb" {
+		t.Errorf("unexpected data: %s", data)
+	}
+
+	err = store.Remove("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Get("upload")
+	if !errors.Is(err, resumable.ErrSessionNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFileStore_Metadata(t *testing.T) {
+	t.Parallel()
+
+	store, err := resumable.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.CreateWithMetadata("upload", 10, map[string]string{"filename": "video.mp4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Create("other", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := store.Metadata("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(metadata, map[string]string{"filename": "video.mp4"}) {
+		t.Errorf("unexpected metadata: %v", metadata)
+	}
+
+	metadata, err = store.Metadata("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != 0 {
+		t.Errorf("unexpected metadata: %v", metadata)
+	}
+
+	err = store.Remove("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Metadata("upload")
+	if !errors.Is(err, resumable.ErrSessionNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFileStore_Claim(t *testing.T) {
+	t.Parallel()
+
+	store, err := resumable.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Claim("upload")
+	if !errors.Is(err, resumable.ErrSessionNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = store.Create("upload", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := store.Claim("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Claim("upload")
+	if !errors.Is(err, resumable.ErrCompleting) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	release()
+
+	release, err = store.Claim("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// removing the session ends the claim
+	err = store.Remove("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Create("upload", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRelease, err := store.Claim("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stale release does not end the new claim
+	release()
+	_, err = store.Claim("upload")
+	if !errors.Is(err, resumable.ErrCompleting) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	newRelease()
+}
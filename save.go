@@ -0,0 +1,199 @@
+package formstream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrFileExists is returned when the file to save exists and WithOverwrite is not given.
+	ErrFileExists = errors.New("file already exists")
+	// ErrInvalidFileName is returned when the file name is not a single path element.
+	ErrInvalidFileName = errors.New("invalid file name")
+	// ErrFileTooLarge is returned when the part exceeds WithMaxFileSize.
+	ErrFileTooLarge = errors.New("file too large")
+)
+
+type saveConfig struct {
+	sync        bool
+	overwrite   bool
+	maxFileSize DataSize
+}
+
+type SaveOption func(*saveConfig)
+
+// WithSync flushes the file to the storage before renaming it into place.
+func WithSync() SaveOption {
+	return func(c *saveConfig) {
+		c.sync = true
+	}
+}
+
+// WithOverwrite allows replacing an existing file.
+// By default, SaveTo fails with ErrFileExists.
+func WithOverwrite() SaveOption {
+	return func(c *saveConfig) {
+		c.overwrite = true
+	}
+}
+
+// WithMaxFileSize sets the maximum size of the file.
+// If the part is larger, SaveTo fails with ErrFileTooLarge and removes the partial file.
+// default: no limit
+func WithMaxFileSize(maxFileSize DataSize) SaveOption {
+	return func(c *saveConfig) {
+		c.maxFileSize = maxFileSize
+	}
+}
+
+// SaveTo returns a hook that saves the part to dir under the name returned by naming.
+// The part is written to a temp file in dir and renamed into place only after it is fully written,
+// so the file never appears partially written and is removed on failure.
+// The name must be a single path element; otherwise the hook fails with ErrInvalidFileName.
+// Note that the file names sent by some browsers contain the full path of the file, which are rejected as well.
+func SaveTo(dir string, naming func(Header) string, options ...SaveOption) StreamHookFunc {
+	return SaveToDestination(DirDestination(dir), naming, options...)
+}
+
+// SaveToDestination is SaveTo writing to dest.
+func SaveToDestination(dest Destination, naming func(Header) string, options ...SaveOption) StreamHookFunc {
+	c := &saveConfig{}
+	for _, opt := range options {
+		opt(c)
+	}
+
+	return func(r io.Reader, header Header) error {
+		name := naming(header)
+		err := validateFileName(name)
+		if err != nil {
+			return err
+		}
+
+		if mover, ok := dest.(fileMover); ok {
+			if fr, ok := r.(FileReader); ok {
+				f, err := fr.AsFile()
+				if err == nil {
+					return c.moveFile(dest, mover, f, name)
+				}
+			}
+		}
+
+		return c.writeFile(dest, r, name)
+	}
+}
+
+// validateFileName checks that name is a single path element, so that the file stays in the destination.
+// Names with directories are rejected rather than stripped, as they are likely crafted (e.g. "../../etc/passwd").
+func validateFileName(name string) error {
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) || !filepath.IsLocal(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidFileName, name)
+	}
+
+	return nil
+}
+
+// moveFile moves the temp file of the part into place without copying it.
+// It falls back to copying when the temp file is on another file system.
+func (c *saveConfig) moveFile(dest Destination, mover fileMover, f *os.File, name string) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+	if c.maxFileSize > 0 && DataSize(stat.Size()) > c.maxFileSize {
+		return ErrFileTooLarge
+	}
+
+	if c.sync {
+		err := f.Sync()
+		if err != nil {
+			return fmt.Errorf("failed to sync: %w", err)
+		}
+	}
+
+	err = mover.moveFile(f, name, c.overwrite)
+	var linkErr *os.LinkError
+	switch {
+	case errors.Is(err, fs.ErrExist):
+		return fmt.Errorf("%w: %s", ErrFileExists, name)
+	case errors.As(err, &linkErr):
+		// e.g. the temp file is on another file system
+		return c.writeFile(dest, f, name)
+	case err != nil:
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+
+	return c.syncDestination(dest)
+}
+
+// writeFile writes r to a temp file in dest and renames it to name.
+func (c *saveConfig) writeFile(dest Destination, r io.Reader, name string) (err error) {
+	f, err := dest.CreateTemp(".formstream-save-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = dest.Remove(f.Name())
+		}
+	}()
+
+	if c.maxFileSize > 0 {
+		// read one more byte to detect the limit violation
+		r = io.LimitReader(r, int64(c.maxFileSize)+1)
+	}
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return fmt.Errorf("failed to copy: %w", err)
+	}
+	if c.maxFileSize > 0 && DataSize(n) > c.maxFileSize {
+		return ErrFileTooLarge
+	}
+
+	if c.sync {
+		err := f.Sync()
+		if err != nil {
+			return fmt.Errorf("failed to sync: %w", err)
+		}
+	}
+
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+
+	err = dest.Rename(f.Name(), name, c.overwrite)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrFileExists, name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rename: %w", err)
+	}
+
+	return c.syncDestination(dest)
+}
+
+// syncDestination flushes the directory entries with WithSync.
+func (c *saveConfig) syncDestination(dest Destination) error {
+	if !c.sync {
+		return nil
+	}
+
+	syncer, ok := dest.(interface{ Sync() error })
+	if !ok {
+		return nil
+	}
+
+	err := syncer.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync destination: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,326 @@
+package formstream_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"maps"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mazrean/formstream"
+)
+
+func TestSaveTo(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fileName       string
+		existing       bool
+		parserOptions  []formstream.ParserOption
+		options        []formstream.SaveOption
+		expectedName   string
+		expectedExists bool
+		err            error
+	}{
+		"normal": {
+			fileName:       "test.txt",
+			expectedName:   "test.txt",
+			expectedExists: true,
+		},
+		"sync": {
+			fileName:       "test.txt",
+			options:        []formstream.SaveOption{formstream.WithSync()},
+			expectedName:   "test.txt",
+			expectedExists: true,
+		},
+		"directory in name": {
+			fileName: `C:\Users\test\test.txt`,
+			err:      formstream.ErrInvalidFileName,
+		},
+		"parent directory in name": {
+			fileName: "../../etc/passwd",
+			err:      formstream.ErrInvalidFileName,
+		},
+		"invalid name": {
+			fileName: "..",
+			err:      formstream.ErrInvalidFileName,
+		},
+		"exists": {
+			fileName:       "test.txt",
+			existing:       true,
+			expectedName:   "test.txt",
+			expectedExists: false,
+			err:            formstream.ErrFileExists,
+		},
+		"overwrite": {
+			fileName:       "test.txt",
+			existing:       true,
+			options:        []formstream.SaveOption{formstream.WithOverwrite()},
+			expectedName:   "test.txt",
+			expectedExists: true,
+		},
+		"too large": {
+			fileName:     "test.txt",
+			options:      []formstream.SaveOption{formstream.WithMaxFileSize(10)},
+			expectedName: "test.txt",
+			err:          formstream.ErrFileTooLarge,
+		},
+		"spilled file": {
+			fileName: "test.txt",
+			parserOptions: []formstream.ParserOption{
+				formstream.WithMaxMemFileSize(10),
+				formstream.WithSpillFilePerPart(),
+			},
+			expectedName:   "test.txt",
+			expectedExists: true,
+		},
+		"spilled file(too large)": {
+			fileName: "test.txt",
+			parserOptions: []formstream.ParserOption{
+				formstream.WithMaxMemFileSize(10),
+				formstream.WithSpillFilePerPart(),
+			},
+			options:      []formstream.SaveOption{formstream.WithMaxFileSize(10)},
+			expectedName: "test.txt",
+			err:          formstream.ErrFileTooLarge,
+		},
+	}
+
+	content := strings.Repeat("a", 100)
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			if tt.existing {
+				err := os.WriteFile(filepath.Join(dir, tt.expectedName), []byte("existing"), 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sb := &strings.Builder{}
+			mw := multipart.NewWriter(sb)
+			err := mw.SetBoundary(boundary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw, err := mw.CreateFormFile("file", tt.fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = fw.Write([]byte(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.WriteField("field", "value")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parser := formstream.NewParser(boundary, tt.parserOptions...)
+			err = parser.Register("file", formstream.SaveTo(dir, formstream.Header.FileName, tt.options...), formstream.WithRequiredPart("field"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(strings.NewReader(sb.String()))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if entry.Name() != tt.expectedName {
+					t.Errorf("unexpected file: %s", entry.Name())
+				}
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, tt.expectedName))
+			switch {
+			case tt.expectedExists && err != nil:
+				t.Fatalf("failed to read file: %v", err)
+			case tt.expectedExists && string(data) != content:
+				t.Errorf("unexpected content: %s", data)
+			case !tt.expectedExists && !tt.existing && err == nil:
+				t.Errorf("file should not exist")
+			case tt.existing && !tt.expectedExists && string(data) != "existing":
+				t.Errorf("existing file is overwritten")
+			}
+		})
+	}
+}
+
+// memDestination is an in-memory formstream.Destination.
+type memDestination struct {
+	locker sync.Mutex
+	files  map[string][]byte
+	seq    int
+}
+
+type memFile struct {
+	bytes.Buffer
+	dest *memDestination
+	name string
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.dest.locker.Lock()
+	defer f.dest.locker.Unlock()
+
+	f.dest.files[f.name] = f.Bytes()
+
+	return nil
+}
+
+func (d *memDestination) CreateTemp(pattern string) (formstream.DestinationFile, error) {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	d.seq++
+	name := strings.Replace(pattern, "*", strconv.Itoa(d.seq), 1)
+	d.files[name] = nil
+
+	return &memFile{dest: d, name: name}, nil
+}
+
+func (d *memDestination) Rename(oldName, newName string, replace bool) error {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	if _, ok := d.files[newName]; ok && !replace {
+		return fs.ErrExist
+	}
+
+	d.files[newName] = d.files[oldName]
+	delete(d.files, oldName)
+
+	return nil
+}
+
+func (d *memDestination) Remove(name string) error {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	delete(d.files, name)
+
+	return nil
+}
+
+func TestSaveToDestination(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		existing bool
+		options  []formstream.SaveOption
+		expected map[string]string
+		err      error
+	}{
+		"normal": {
+			expected: map[string]string{"test.txt": "content"},
+		},
+		"exists": {
+			existing: true,
+			expected: map[string]string{"test.txt": "existing"},
+			err:      formstream.ErrFileExists,
+		},
+		"overwrite": {
+			existing: true,
+			options:  []formstream.SaveOption{formstream.WithOverwrite()},
+			expected: map[string]string{"test.txt": "content"},
+		},
+		"too large": {
+			options:  []formstream.SaveOption{formstream.WithMaxFileSize(1)},
+			expected: map[string]string{},
+			err:      formstream.ErrFileTooLarge,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dest := &memDestination{files: map[string][]byte{}}
+			if tt.existing {
+				dest.files["test.txt"] = []byte("existing")
+			}
+
+			hook := formstream.SaveToDestination(dest, func(formstream.Header) string {
+				return "test.txt"
+			}, tt.options...)
+
+			err := hook(strings.NewReader("content"), formstream.Header{})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			actual := make(map[string]string, len(dest.files))
+			for name, data := range dest.files {
+				actual[name] = string(data)
+			}
+			if !maps.Equal(actual, tt.expected) {
+				t.Errorf("unexpected files: %v", actual)
+			}
+		})
+	}
+}
+
+func TestRootDestination(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	hook := formstream.SaveToDestination(formstream.RootDestination(root), func(formstream.Header) string {
+		return "test.txt"
+	}, formstream.WithSync())
+
+	for _, expectedErr := range []error{nil, formstream.ErrFileExists} {
+		err = hook(strings.NewReader("content"), formstream.Header{})
+		if !errors.Is(err, expectedErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "test.txt" {
+		t.Errorf("unexpected files: %v", entries)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "test.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "content" {
+		t.Errorf("unexpected content: %s", data)
+	}
+}
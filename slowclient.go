@@ -0,0 +1,159 @@
+package formstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrClientTooSlow is returned when the client sends the body slower than WithIdleTimeout or WithMinThroughput allow.
+var ErrClientTooSlow = errors.New("client too slow")
+
+// WithIdleTimeout fails parsing with ErrClientTooSlow if no data of the body arrives for timeout.
+// The time spent in the hooks is not counted.
+// The read of the body waiting for the data is left running in background after the failure.
+// With net/http, it holds the body and keeps the response from being sent until it is unblocked,
+// e.g. with http.ResponseController.SetReadDeadline. The web framework integrations do it
+// (httpform.WriteError, and Parse of ginform and echoform); otherwise set http.Server.ReadTimeout.
+func WithIdleTimeout(timeout time.Duration) ParserOption {
+	return func(c *parserConfig) {
+		c.idleTimeout = timeout
+	}
+}
+
+// WithMinThroughput fails parsing with ErrClientTooSlow if the average speed of the body falls below bytesPerSec bytes per second.
+// The speed is measured over the time waiting for the client, so the time spent in the hooks is not counted,
+// and checked after waiting for gracePeriod in total.
+func WithMinThroughput(bytesPerSec int, gracePeriod time.Duration) ParserOption {
+	return func(c *parserConfig) {
+		c.minThroughput = bytesPerSec
+		c.throughputGracePeriod = gracePeriod
+	}
+}
+
+type readResult struct {
+	data []byte
+	err  error
+}
+
+// slowClientReader reads r in background, to give up waiting for slow clients.
+type slowClientReader struct {
+	ctx         context.Context
+	idleTimeout time.Duration
+	minRate     int
+	gracePeriod time.Duration
+
+	results chan readResult
+	ack     chan struct{}
+	done    chan struct{}
+
+	pending []byte
+	err     error
+	// needAck the pending data is from the buffer of the background read, which waits for it to be consumed
+	needAck bool
+
+	bytesRead int64
+	waited    time.Duration
+}
+
+func (p *Parser) newSlowClientReader(ctx context.Context, r io.Reader) *slowClientReader {
+	sr := &slowClientReader{
+		ctx:         ctx,
+		idleTimeout: p.idleTimeout,
+		minRate:     p.minThroughput,
+		gracePeriod: p.throughputGracePeriod,
+		results:     make(chan readResult),
+		ack:         make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	go sr.pump(r)
+
+	return sr
+}
+
+// pump reads r into its buffer, and waits for the data to be consumed before reusing the buffer.
+func (sr *slowClientReader) pump(r io.Reader) {
+	buf := make([]byte, 32*KB)
+	for {
+		n, err := r.Read(buf)
+
+		select {
+		case sr.results <- readResult{data: buf[:n], err: err}:
+		case <-sr.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-sr.ack:
+		case <-sr.done:
+			return
+		}
+	}
+}
+
+func (sr *slowClientReader) Read(p []byte) (int, error) {
+	for len(sr.pending) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+
+		err := sr.wait()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, sr.pending)
+	sr.pending = sr.pending[n:]
+
+	return n, nil
+}
+
+// wait waits for the next data from the background read.
+func (sr *slowClientReader) wait() error {
+	if sr.needAck {
+		sr.ack <- struct{}{}
+		sr.needAck = false
+	}
+
+	var timeout <-chan time.Time
+	if sr.idleTimeout > 0 {
+		timer := time.NewTimer(sr.idleTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	start := time.Now()
+	select {
+	case res := <-sr.results:
+		sr.pending = res.data
+		sr.err = res.err
+		sr.needAck = res.err == nil
+	case <-timeout:
+		return fmt.Errorf("%w: no data for %s", ErrClientTooSlow, sr.idleTimeout)
+	case <-sr.ctx.Done():
+		return sr.ctx.Err()
+	}
+	sr.waited += time.Since(start)
+	sr.bytesRead += int64(len(sr.pending))
+
+	if sr.minRate > 0 && sr.waited >= sr.gracePeriod {
+		rate := float64(sr.bytesRead) / sr.waited.Seconds()
+		if rate < float64(sr.minRate) {
+			return fmt.Errorf("%w: %.0f bytes/sec", ErrClientTooSlow, rate)
+		}
+	}
+
+	return nil
+}
+
+// Close stops the background read.
+func (sr *slowClientReader) Close() {
+	close(sr.done)
+}
@@ -0,0 +1,93 @@
+package formstream_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mazrean/formstream"
+)
+
+func TestSlowClient(t *testing.T) {
+	t.Parallel()
+
+	form := "--" + boundary + "\r\n" +
+		"Content-Disposition: form-data; name=\"stream\"\r\n\r\n" +
+		strings.Repeat("a", 1000) + "\r\n" +
+		"--" + boundary + "--\r\n"
+
+	tests := map[string]struct {
+		options []formstream.ParserOption
+		// chunkSize the size of the chunks the client sends
+		chunkSize int
+		// interval the interval between the chunks
+		interval time.Duration
+		// hookDelay the time the hook takes, which must not be counted
+		hookDelay time.Duration
+		err       error
+	}{
+		"fast": {
+			options: []formstream.ParserOption{
+				formstream.WithIdleTimeout(time.Second),
+				formstream.WithMinThroughput(1000, 10*time.Millisecond),
+			},
+			chunkSize: len(form),
+		},
+		"slow hook": {
+			options: []formstream.ParserOption{
+				formstream.WithIdleTimeout(50 * time.Millisecond),
+				formstream.WithMinThroughput(1000, 10*time.Millisecond),
+			},
+			chunkSize: len(form),
+			hookDelay: 200 * time.Millisecond,
+		},
+		"idle": {
+			options:   []formstream.ParserOption{formstream.WithIdleTimeout(50 * time.Millisecond)},
+			chunkSize: 100,
+			interval:  time.Second,
+			err:       formstream.ErrClientTooSlow,
+		},
+		"trickle": {
+			options:   []formstream.ParserOption{formstream.WithMinThroughput(10000, 50*time.Millisecond)},
+			chunkSize: 10,
+			interval:  10 * time.Millisecond,
+			err:       formstream.ErrClientTooSlow,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			pr, pw := io.Pipe()
+			go func() {
+				for i := 0; i < len(form); i += tt.chunkSize {
+					_, err := pw.Write([]byte(form[i:min(i+tt.chunkSize, len(form))]))
+					if err != nil {
+						return
+					}
+					time.Sleep(tt.interval)
+				}
+				pw.Close()
+			}()
+			defer pr.Close()
+
+			parser := formstream.NewParser(boundary, tt.options...)
+			err := parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+				time.Sleep(tt.hookDelay)
+				_, err := io.Copy(io.Discard, r)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(pr)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
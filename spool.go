@@ -0,0 +1,150 @@
+package formstream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrSpoolTooLarge is returned when the part is too large to retry the hook from the spooled copy.
+var ErrSpoolTooLarge = errors.New("too large part to spool")
+
+// spool keeps a copy of a part read on the streaming path.
+// Write never fails, so that the hook reading the part is not affected by the spool.
+// Once the copy exceeds the limits, the spool stops copying and the copy is unavailable.
+type spool struct {
+	pp  *preProcessor
+	buf *bytes.Buffer
+	// mem writes to buf within the budget
+	mem         *memoryWriter
+	file        *spillFile
+	memLimit    DataSize
+	maxDiskSize DataSize
+	onDisk      bool
+	diskSize    int64
+	overflowed  bool
+	err         error
+}
+
+func (pp *preProcessor) newSpool(maxDiskSize DataSize) *spool {
+	buf, ok := bufPool.Get().(*bytes.Buffer)
+	if !ok {
+		buf = new(bytes.Buffer)
+	}
+	buf.Reset()
+
+	return &spool{
+		pp:          pp,
+		buf:         buf,
+		mem:         &memoryWriter{pp: pp, buf: buf},
+		memLimit:    min(pp.config.maxMemFileSize, pp.config.maxMemSize),
+		maxDiskSize: maxDiskSize,
+	}
+}
+
+func (s *spool) Write(p []byte) (int, error) {
+	if s.overflowed {
+		return len(p), nil
+	}
+
+	if !s.onDisk {
+		if DataSize(s.buf.Len()+len(p)) <= s.memLimit {
+			_, err := s.mem.Write(p)
+			if errors.Is(err, errBudgetSpill) {
+				// p is in buf, so moving buf to disk completes the copy
+				err = s.spill()
+				if err != nil {
+					s.overflowed = true
+					s.err = err
+				}
+
+				return len(p), nil
+			}
+			if err != nil {
+				s.overflowed = true
+				s.err = err
+			}
+
+			return len(p), nil
+		}
+
+		if DataSize(s.buf.Len()+len(p)) > s.maxDiskSize {
+			s.overflowed = true
+			return len(p), nil
+		}
+
+		err := s.spill()
+		if err != nil {
+			s.overflowed = true
+			s.err = err
+			return len(p), nil
+		}
+	}
+
+	if DataSize(s.diskSize+int64(len(p))) > s.maxDiskSize {
+		s.overflowed = true
+		return len(p), nil
+	}
+
+	n, err := diskWriter{pp: s.pp, file: s.file}.Write(p)
+	s.diskSize += int64(n)
+	if err != nil {
+		s.overflowed = true
+		s.err = fmt.Errorf("failed to write: %w", err)
+	}
+
+	return len(p), nil
+}
+
+// content returns the spooled copy.
+// The spool must not be used after calling content.
+func (s *spool) content() (bufferedContent, error) {
+	if s.overflowed {
+		s.discard()
+		if s.err != nil {
+			return nil, errors.Join(ErrSpoolTooLarge, s.err)
+		}
+
+		return nil, ErrSpoolTooLarge
+	}
+
+	if !s.onDisk {
+		// the memory is reserved while writing
+		return s.pp.memoryContent(s.buf), nil
+	}
+
+	bufPool.Put(s.buf)
+	return s.pp.fileContent(s.file, s.diskSize), nil
+}
+
+// spill moves the spooled copy on memory to the temp file.
+func (s *spool) spill() error {
+	f, err := s.pp.spillFile()
+	if err != nil {
+		return err
+	}
+	s.file = f
+
+	n, err := s.buf.WriteTo(diskWriter{pp: s.pp, file: f})
+	s.diskSize += n
+	s.pp.releaseMemory(s.mem.reserved)
+	s.mem.reserved = 0
+	if err != nil {
+		return fmt.Errorf("failed to write: %w", err)
+	}
+	s.onDisk = true
+
+	return nil
+}
+
+// discard releases the spooled copy.
+// The spool must not be used after calling discard.
+func (s *spool) discard() {
+	s.pp.releaseMemory(s.mem.reserved)
+	s.mem.reserved = 0
+	bufPool.Put(s.buf)
+
+	if s.file != nil {
+		s.pp.discardFile(s.file, s.diskSize)
+	}
+}
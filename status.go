@@ -0,0 +1,191 @@
+package formstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrMalformed is returned when the body is not a valid multipart form.
+var ErrMalformed = errors.New("malformed multipart form")
+
+// StatusClientClosedRequest is the non-standard status code for the requests canceled by the client.
+const StatusClientClosedRequest = 499
+
+// HookError is returned when a stream hook fails.
+type HookError struct {
+	// Name the name of the hook.
+	Name string
+	Err  error
+}
+
+func (e HookError) Error() string {
+	return fmt.Sprintf("hook(%s): %v", e.Name, e.Err)
+}
+
+func (e HookError) Unwrap() error {
+	return e.Err
+}
+
+// StatusError is an error with the HTTP status code to respond with.
+// Stream hooks can return it to choose the response of the web framework integrations.
+type StatusError struct {
+	Status int
+	Err    error
+}
+
+func (e StatusError) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.Status)
+	}
+
+	return e.Err.Error()
+}
+
+func (e StatusError) Unwrap() error {
+	return e.Err
+}
+
+// bodyError is an error of reading the body, e.g. the client disconnected while a hook was reading the part.
+// It tells the errors of the client apart from the errors of the hooks themselves.
+type bodyError struct {
+	err error
+}
+
+func (e bodyError) Error() string {
+	return e.err.Error()
+}
+
+func (e bodyError) Unwrap() error {
+	return e.err
+}
+
+// bodyReader marks the errors of reading r as bodyError.
+type bodyReader struct {
+	r io.Reader
+}
+
+func (br bodyReader) Read(p []byte) (int, error) {
+	n, err := br.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = bodyError{err: err}
+	}
+
+	return n, err
+}
+
+// StatusCode returns the HTTP status code to respond with for the error of parsing.
+//   - StatusError: its status
+//   - the limits exceeded (e.g. ErrTooLargeForm, ErrTooManyParts, http.MaxBytesError): 413
+//   - ErrBudgetExceeded: 503
+//   - the client too slow (ErrClientTooSlow, context.DeadlineExceeded): 408
+//   - the client disconnected (context.Canceled, io.ErrUnexpectedEOF): 499
+//   - unsupported encodings and formats: 415
+//   - malformed or rejected forms (e.g. ErrMalformed, ErrPartRejected): 400
+//   - others: 500
+//
+// The errors of the hooks (HookError) are 500, unless they are caused by reading the body
+// or by the limits and validations of formstream (e.g. ErrFileTooLarge, ErrUnsafeEntry),
+// so that the failures of the hooks themselves (e.g. a storage timing out) are not blamed on the client.
+// It returns 200 for nil.
+func StatusCode(err error) int {
+	var (
+		statusErr StatusError
+		bodyErr   bodyError
+		hookErr   HookError
+	)
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.As(err, &statusErr):
+		return statusErr.Status
+	case errors.As(err, &bodyErr):
+		if code, ok := readStatusCode(bodyErr.err); ok {
+			return code
+		}
+		if code, ok := formStatusCode(bodyErr.err); ok {
+			return code
+		}
+
+		return http.StatusBadRequest
+	case errors.As(err, &hookErr):
+		if code, ok := formStatusCode(hookErr.Err); ok {
+			return code
+		}
+
+		return http.StatusInternalServerError
+	}
+
+	if code, ok := readStatusCode(err); ok {
+		return code
+	}
+	if code, ok := formStatusCode(err); ok {
+		return code
+	}
+
+	return http.StatusInternalServerError
+}
+
+// readStatusCode returns the status code for the errors of reading the body.
+func readStatusCode(err error) (int, bool) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, true
+	case errors.Is(err, ErrClientTooSlow),
+		errors.Is(err, context.DeadlineExceeded):
+		return http.StatusRequestTimeout, true
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return StatusClientClosedRequest, true
+	}
+
+	return 0, false
+}
+
+// formStatusCode returns the status code for the limits and validations of formstream.
+func formStatusCode(err error) (int, bool) {
+	switch {
+	case errors.Is(err, ErrTooLargeForm),
+		errors.Is(err, ErrTooManyParts),
+		errors.Is(err, ErrTooManyHeaders),
+		errors.Is(err, ErrFileTooLarge),
+		errors.Is(err, ErrImageTooLarge),
+		errors.Is(err, ErrArchiveTooLarge),
+		errors.Is(err, ErrTooManyEntries):
+		return http.StatusRequestEntityTooLarge, true
+	case errors.Is(err, ErrBudgetExceeded):
+		return http.StatusServiceUnavailable, true
+	case errors.Is(err, ErrUnsupportedEncoding),
+		errors.Is(err, ErrUnsupportedImage):
+		return http.StatusUnsupportedMediaType, true
+	case errors.Is(err, ErrMalformed),
+		errors.Is(err, ErrPartRejected),
+		errors.Is(err, ErrOutOfOrder),
+		errors.Is(err, ErrHookDidNotConsume),
+		errors.Is(err, ErrUnsafeEntry),
+		errors.Is(err, ErrInvalidFileName):
+		return http.StatusBadRequest, true
+	}
+
+	return 0, false
+}
+
+// StatusMessage returns the message to respond with for the error of parsing.
+// It is the message of StatusError, or the text of the status code,
+// so the details of the other errors are not exposed to the client.
+func StatusMessage(err error) string {
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Error()
+	}
+
+	code := StatusCode(err)
+	if code == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+
+	return http.StatusText(code)
+}
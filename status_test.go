@@ -0,0 +1,198 @@
+package formstream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mazrean/formstream"
+)
+
+func TestStatusCode(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		err      error
+		expected int
+		message  string
+	}{
+		"nil": {
+			err:      nil,
+			expected: http.StatusOK,
+			message:  "OK",
+		},
+		"too large": {
+			err:      fmt.Errorf("failed to copy part: %w", formstream.ErrTooLargeForm),
+			expected: http.StatusRequestEntityTooLarge,
+			message:  "Request Entity Too Large",
+		},
+		"too many parts": {
+			err:      formstream.ErrTooManyParts,
+			expected: http.StatusRequestEntityTooLarge,
+			message:  "Request Entity Too Large",
+		},
+		"too many headers": {
+			err:      formstream.ErrTooManyHeaders,
+			expected: http.StatusRequestEntityTooLarge,
+			message:  "Request Entity Too Large",
+		},
+		"malformed": {
+			err:      fmt.Errorf("%w: failed to read next part", formstream.ErrMalformed),
+			expected: http.StatusBadRequest,
+			message:  "Bad Request",
+		},
+		"too slow": {
+			err:      fmt.Errorf("%w: failed to read next part: %w", formstream.ErrMalformed, formstream.ErrClientTooSlow),
+			expected: http.StatusRequestTimeout,
+			message:  "Request Timeout",
+		},
+		"disconnected": {
+			err:      fmt.Errorf("%w: failed to read next part: %w", formstream.ErrMalformed, io.ErrUnexpectedEOF),
+			expected: formstream.StatusClientClosedRequest,
+			message:  "Client Closed Request",
+		},
+		"canceled": {
+			err:      context.Canceled,
+			expected: formstream.StatusClientClosedRequest,
+			message:  "Client Closed Request",
+		},
+		"hook error": {
+			err:      formstream.HookError{Name: "stream", Err: errTest},
+			expected: http.StatusInternalServerError,
+			message:  "Internal Server Error",
+		},
+		"hook timed out": {
+			err:      formstream.HookError{Name: "stream", Err: fmt.Errorf("failed to upload: %w", context.DeadlineExceeded)},
+			expected: http.StatusInternalServerError,
+			message:  "Internal Server Error",
+		},
+		"hook disconnected": {
+			err:      formstream.HookError{Name: "stream", Err: fmt.Errorf("failed to upload: %w", io.ErrUnexpectedEOF)},
+			expected: http.StatusInternalServerError,
+			message:  "Internal Server Error",
+		},
+		"hook rejected": {
+			err:      formstream.HookError{Name: "stream", Err: fmt.Errorf("failed to save: %w", formstream.ErrFileTooLarge)},
+			expected: http.StatusRequestEntityTooLarge,
+			message:  "Request Entity Too Large",
+		},
+		"max bytes": {
+			err:      fmt.Errorf("%w: failed to read next part: %w", formstream.ErrMalformed, &http.MaxBytesError{Limit: 10}),
+			expected: http.StatusRequestEntityTooLarge,
+			message:  "Request Entity Too Large",
+		},
+		"status error": {
+			err: formstream.HookError{Name: "stream", Err: formstream.StatusError{
+				Status: http.StatusConflict,
+				Err:    errors.New("user already exists"),
+			}},
+			expected: http.StatusConflict,
+			message:  "user already exists",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if code := formstream.StatusCode(tt.err); code != tt.expected {
+				t.Errorf("unexpected status code: %d", code)
+			}
+			if message := formstream.StatusMessage(tt.err); message != tt.message {
+				t.Errorf("unexpected message: %s", message)
+			}
+		})
+	}
+}
+
+func TestHookError(t *testing.T) {
+	t.Parallel()
+
+	parser := formstream.NewParser(boundary)
+	err := parser.Register("stream", func(io.Reader, formstream.Header) error {
+		return formstream.StatusError{Status: http.StatusConflict, Err: errTest}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb := &strings.Builder{}
+	err = createSampleForm(sb, 1*formstream.KB, boundary, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = parser.Parse(strings.NewReader(sb.String()))
+
+	var hookErr formstream.HookError
+	if !errors.As(err, &hookErr) || hookErr.Name != "stream" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !errors.Is(err, errTest) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if code := formstream.StatusCode(err); code != http.StatusConflict {
+		t.Errorf("unexpected status code: %d", code)
+	}
+
+	err = formstream.NewParser(boundary).Parse(strings.NewReader("--" + boundary + "\r\ninvalid header\r\n\r\nvalue\r\n--" + boundary + "--\r\n"))
+	if code := formstream.StatusCode(err); code != http.StatusBadRequest {
+		t.Errorf("unexpected status code for malformed body: %d(%v)", code, err)
+	}
+}
+
+func TestStatusCode_hookReadingBody(t *testing.T) {
+	t.Parallel()
+
+	sb := &strings.Builder{}
+	err := createSampleForm(sb, 1*formstream.MB, boundary, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := sb.String()
+
+	tests := map[string]struct {
+		body     string
+		hookErr  error
+		expected int
+	}{
+		"body error": {
+			// the client disconnects in the middle of the stream part
+			body:     form[:strings.Index(form, `name="stream"`)+1000],
+			expected: formstream.StatusClientClosedRequest,
+		},
+		"hook's own error": {
+			body:     form,
+			hookErr:  context.DeadlineExceeded,
+			expected: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			parser := formstream.NewParser(boundary)
+			err := parser.Register("stream", func(r io.Reader, _ formstream.Header) error {
+				_, err := io.Copy(io.Discard, r)
+				if err != nil {
+					return fmt.Errorf("failed to upload: %w", err)
+				}
+
+				return fmt.Errorf("failed to upload: %w", tt.hookErr)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(strings.NewReader(tt.body))
+			if code := formstream.StatusCode(err); code != tt.expected {
+				t.Errorf("unexpected status code: %d(%v)", code, err)
+			}
+		})
+	}
+}
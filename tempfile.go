@@ -0,0 +1,263 @@
+package formstream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const tempFilePrefix = "formstream-"
+
+// ErrNotFile is returned by FileReader.AsFile when the part is not buffered on its own temp file.
+var ErrNotFile = errors.New("part is not buffered on its own file")
+
+// FileReader is implemented by the reader passed to the hook when the part may be buffered on its own temp file (see WithSpillFilePerPart).
+// It lets the hook move the data into place (e.g. os.Rename) without copying it.
+//
+//	if fr, ok := r.(formstream.FileReader); ok {
+//		f, err := fr.AsFile()
+//		if err == nil {
+//			return os.Rename(f.Name(), dst)
+//		}
+//	}
+type FileReader interface {
+	io.Reader
+	// AsFile returns the temp file holding the whole part, positioned at its start.
+	// The part is treated as consumed.
+	// The hook may rename the file; it is closed and removed (if still there) after the hook finishes.
+	// It returns ErrNotFile if the temp file has been unlinked (see WithUnlinkTempFiles).
+	AsFile() (*os.File, error)
+}
+
+// WithTempDir sets the directory for the temp files to buffer the parts.
+// default: os.TempDir()
+func WithTempDir(dir string) ParserOption {
+	return func(c *parserConfig) {
+		c.tempDir = dir
+	}
+}
+
+// WithSpillFilePerPart creates a temp file for each part buffered on disk, instead of appending all parts to one temp file.
+// The temp file is removed as soon as the hook of the part finishes, so the disk space is freed early.
+func WithSpillFilePerPart() ParserOption {
+	return func(c *parserConfig) {
+		c.spillFilePerPart = true
+	}
+}
+
+// WithUnlinkTempFiles removes the temp files from the directory right after creating them,
+// so that they do not remain even if the process crashes.
+// The data is still accessible through the open file.
+// It has no effect on the platforms that do not allow removing open files (e.g. Windows).
+func WithUnlinkTempFiles() ParserOption {
+	return func(c *parserConfig) {
+		c.unlinkTempFiles = true
+	}
+}
+
+// CleanupStale removes the temp files of formstream in dir that were last modified more than olderThan ago.
+// It is intended to be called at startup, to remove the files left by a crashed process.
+// If dir is empty, os.TempDir() is used.
+func CleanupStale(dir string, olderThan time.Duration) error {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read dir: %w", err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasPrefix(entry.Name(), tempFilePrefix) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get file info: %w", err))
+			continue
+		}
+
+		if time.Since(info.ModTime()) < olderThan {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(dir, entry.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("failed to remove file: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// spillFile is a temp file to buffer the parts.
+type spillFile struct {
+	file *os.File
+	// offset the start of the next part
+	offset int64
+	// diskSize the size reserved from the budget
+	diskSize DataSize
+	unlinked bool
+	closed   bool
+}
+
+// spillFile returns the temp file to write the next part.
+func (pp *preProcessor) spillFile() (*spillFile, error) {
+	if !pp.config.spillFilePerPart && pp.file != nil {
+		return pp.file, nil
+	}
+
+	f, err := os.CreateTemp(pp.config.tempDir, tempFilePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	sf := &spillFile{file: f}
+	if pp.config.unlinkTempFiles {
+		sf.unlinked, err = unlinkOpenFile(f)
+		if err != nil {
+			return nil, errors.Join(err, f.Close())
+		}
+	}
+
+	if pp.config.spillFilePerPart {
+		if pp.partFiles == nil {
+			pp.partFiles = make(map[*spillFile]struct{})
+		}
+		pp.partFiles[sf] = struct{}{}
+	} else {
+		pp.file = sf
+	}
+
+	return sf, nil
+}
+
+// fileContent returns the last size bytes written to the temp file.
+func (pp *preProcessor) fileContent(f *spillFile, size int64) bufferedContent {
+	sr := io.NewSectionReader(f.file, f.offset, size)
+	f.offset += size
+
+	if !pp.config.spillFilePerPart {
+		return sectionReadCloser{SectionReader: sr}
+	}
+
+	return &partFileReadCloser{
+		SectionReader: sr,
+		file:          f,
+		closeFunc: func() error {
+			return pp.closePartFile(f)
+		},
+	}
+}
+
+// discardFile drops the last size bytes written to the temp file.
+func (pp *preProcessor) discardFile(f *spillFile, size int64) {
+	if pp.config.spillFilePerPart {
+		_ = pp.closePartFile(f)
+		return
+	}
+
+	// the written bytes can not be reused because the temp file is append only
+	f.offset += size
+}
+
+func (pp *preProcessor) closePartFile(f *spillFile) error {
+	delete(pp.partFiles, f)
+
+	return pp.closeFile(f)
+}
+
+func (pp *preProcessor) closeFile(sf *spillFile) error {
+	if sf.closed {
+		return nil
+	}
+	sf.closed = true
+
+	pp.releaseDisk(sf.diskSize)
+	sf.diskSize = 0
+
+	// Close the file handle first
+	// the hook may have closed it through FileReader.AsFile
+	closeErr := sf.file.Close()
+	if errors.Is(closeErr, os.ErrClosed) {
+		closeErr = nil
+	}
+
+	// Remove the temporary file from disk
+	// the hook may have moved it through FileReader.AsFile
+	var removeErr error
+	if !sf.unlinked {
+		removeErr = os.Remove(sf.file.Name())
+		if errors.Is(removeErr, fs.ErrNotExist) {
+			removeErr = nil
+		}
+	}
+
+	// Return combined errors if any
+	if closeErr != nil || removeErr != nil {
+		return errors.Join(closeErr, removeErr)
+	}
+
+	return nil
+}
+
+func (pp *preProcessor) Close() error {
+	var errs []error
+	if pp.file != nil {
+		errs = append(errs, pp.closeFile(pp.file))
+	}
+
+	// the parts whose hooks never ran
+	for f := range pp.partFiles {
+		errs = append(errs, pp.closePartFile(f))
+	}
+	for _, closeFunc := range pp.memoryContents {
+		errs = append(errs, closeFunc())
+	}
+
+	pp.releaseMemory(pp.valueReserved)
+	pp.valueReserved = 0
+
+	return errors.Join(errs...)
+}
+
+// partFileReadCloser is the content of a part buffered on its own temp file.
+type partFileReadCloser struct {
+	*io.SectionReader
+	file      *spillFile
+	closeFunc func() error
+}
+
+func (pf *partFileReadCloser) AsFile() (*os.File, error) {
+	if pf.file.unlinked {
+		return nil, ErrNotFile
+	}
+
+	_, err := pf.file.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewind: %w", err)
+	}
+
+	// the hook takes the whole part
+	_, err = pf.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seek: %w", err)
+	}
+
+	return pf.file.file, nil
+}
+
+func (pf *partFileReadCloser) Close() error {
+	return pf.closeFunc()
+}
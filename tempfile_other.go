@@ -0,0 +1,10 @@
+//go:build !unix
+
+package formstream
+
+import "os"
+
+// unlinkOpenFile does nothing because the open file can not be removed on this platform.
+func unlinkOpenFile(*os.File) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,251 @@
+package formstream
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTempFileOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		options []ParserOption
+		// filesInHooks the number of temp files left while each hook is running
+		filesInHooks []int
+	}{
+		"shared": {
+			filesInHooks: []int{1, 1},
+		},
+		"per part": {
+			options:      []ParserOption{WithSpillFilePerPart()},
+			filesInHooks: []int{2, 1},
+		},
+		"unlink": {
+			options:      []ParserOption{WithUnlinkTempFiles()},
+			filesInHooks: []int{0, 0},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+
+			sb := &strings.Builder{}
+			mw := multipart.NewWriter(sb)
+			err := mw.SetBoundary("boundary")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"stream1", "stream2"} {
+				err = mw.WriteField(name, strings.Repeat("a", 100))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = mw.WriteField("field", "value")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			options := append([]ParserOption{
+				WithTempDir(dir),
+				WithMaxMemFileSize(10),
+			}, tt.options...)
+			parser := NewParser("boundary", options...)
+
+			var filesInHooks []int
+			hook := func(r io.Reader, _ Header) error {
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					return err
+				}
+				filesInHooks = append(filesInHooks, len(entries))
+
+				_, err = io.Copy(io.Discard, r)
+				return err
+			}
+			for _, name := range []string{"stream1", "stream2"} {
+				err = parser.Register(name, hook, WithRequiredPart("field"))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = parser.Parse(strings.NewReader(sb.String()))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(filesInHooks, tt.filesInHooks) {
+				t.Errorf("unexpected number of temp files in hooks: %v", filesInHooks)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("temp files are left: %v", entries)
+			}
+		})
+	}
+}
+
+func TestCleanupStale(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	old := time.Now().Add(-2 * time.Hour)
+	files := map[string]time.Time{
+		"formstream-old": old,
+		"formstream-new": time.Now(),
+		"other-old":      old,
+	}
+	for name, modTime := range files {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := CleanupStale(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, expected := range map[string]bool{
+		"formstream-old": false,
+		"formstream-new": true,
+		"other-old":      true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != expected {
+			t.Errorf("%s: expected exists=%v, got %v", name, expected, exists)
+		}
+	}
+}
+
+func TestFileReader_AsFile(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		options []ParserOption
+		isFile  bool
+		err     error
+	}{
+		"per part": {
+			options: []ParserOption{WithSpillFilePerPart()},
+			isFile:  true,
+		},
+		"shared": {
+			isFile: false,
+		},
+		"unlink": {
+			options: []ParserOption{WithSpillFilePerPart(), WithUnlinkTempFiles()},
+			isFile:  true,
+			err:     ErrNotFile,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			dst := filepath.Join(t.TempDir(), "dst")
+
+			sb := &strings.Builder{}
+			mw := multipart.NewWriter(sb)
+			err := mw.SetBoundary("boundary")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.WriteField("stream", strings.Repeat("a", 100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.WriteField("field", "value")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			options := append([]ParserOption{
+				WithTempDir(dir),
+				WithMaxMemFileSize(10),
+				WithUnconsumedPolicy(FailUnconsumed),
+			}, tt.options...)
+			parser := NewParser("boundary", options...)
+
+			err = parser.Register("stream", func(r io.Reader, _ Header) error {
+				fr, ok := r.(FileReader)
+				if ok != tt.isFile {
+					t.Fatalf("expected FileReader=%v, got %v", tt.isFile, ok)
+				}
+				if !ok {
+					_, err := io.Copy(io.Discard, r)
+					return err
+				}
+
+				f, err := fr.AsFile()
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err != nil {
+					_, err := io.Copy(io.Discard, r)
+					return err
+				}
+
+				return os.Rename(f.Name(), dst)
+			}, WithRequiredPart("field"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(strings.NewReader(sb.String()))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.isFile && tt.err == nil {
+				data, err := os.ReadFile(dst)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != strings.Repeat("a", 100) {
+					t.Errorf("unexpected content: %s", data)
+				}
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("temp files are left: %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package formstream
+
+import (
+	"fmt"
+	"os"
+)
+
+// unlinkOpenFile removes the open file from the directory.
+func unlinkOpenFile(f *os.File) (bool, error) {
+	err := os.Remove(f.Name())
+	if err != nil {
+		return false, fmt.Errorf("failed to unlink temp file: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,379 @@
+// Package tus implements the server of the tus resumable upload protocol 1.0.0 (https://tus.io/protocols/resumable-upload),
+// with the creation and termination extensions.
+//
+// The uploads are kept in a resumable.Store, and a completed upload is passed to a formstream.StreamHookFunc,
+// so it goes through the same post-processing as the multipart uploads.
+package tus
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mazrean/formstream"
+	"github.com/mazrean/formstream/resumable"
+)
+
+const (
+	// Version the version of the tus protocol implemented.
+	Version    = "1.0.0"
+	extensions = "creation,termination"
+
+	offsetContentType = "application/offset+octet-stream"
+)
+
+type config struct {
+	basePath      string
+	maxSize       formstream.DataSize
+	newID         func() (string, error)
+	parserOptions []formstream.ParserOption
+}
+
+type Option func(*config)
+
+// WithBasePath sets the path the Handler is mounted on.
+// The upload URLs are the base path followed by the upload id.
+// default: "/"
+func WithBasePath(basePath string) Option {
+	return func(c *config) {
+		if !strings.HasSuffix(basePath, "/") {
+			basePath += "/"
+		}
+		c.basePath = basePath
+	}
+}
+
+// WithMaxSize sets the maximum size of an upload.
+// default: no limit
+func WithMaxSize(maxSize formstream.DataSize) Option {
+	return func(c *config) {
+		c.maxSize = maxSize
+	}
+}
+
+// WithIDGenerator sets the function generating the ids of the uploads.
+// The ids must be valid for resumable.ValidateID.
+// default: 32 random hex digits
+func WithIDGenerator(fn func() (string, error)) Option {
+	return func(c *config) {
+		c.newID = fn
+	}
+}
+
+// WithParserOptions sets the options limiting the reads of the PATCH bodies,
+// so that the uploads share the limits of the multipart forms, e.g. formstream.WithIdleTimeout.
+// See formstream.NewBodyReader for the options applied.
+func WithParserOptions(options ...formstream.ParserOption) Option {
+	return func(c *config) {
+		c.parserOptions = append(c.parserOptions, options...)
+	}
+}
+
+func randomID() (string, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b[:]), nil
+}
+
+// Handler is the http.Handler serving the tus protocol.
+type Handler struct {
+	store      resumable.Store
+	onComplete formstream.StreamHookFunc
+	config
+}
+
+// NewHandler returns the Handler keeping the uploads in store.
+// onComplete runs once per upload with the reader over the uploaded data, when the last byte arrives.
+// Its header has the Content-Disposition of a form file named "file", with the "filename" metadata as the file name,
+// and the "filetype" metadata as the Content-Type. The metadata is kept only if store is a resumable.MetadataStore.
+// The upload is removed after onComplete succeeds (see resumable.Complete). If onComplete fails, the upload is kept,
+// and the client retries the completion with a PATCH request of an empty body at the end of the upload.
+func NewHandler(store resumable.Store, onComplete formstream.StreamHookFunc, options ...Option) *Handler {
+	c := config{
+		basePath: "/",
+		newID:    randomID,
+	}
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	return &Handler{
+		store:      store,
+		onComplete: onComplete,
+		config:     c,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", Version)
+
+	if r.Method == http.MethodOptions {
+		h.options(w)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != Version {
+		w.Header().Set("Tus-Version", Version)
+		http.Error(w, "unsupported tus version", http.StatusPreconditionFailed)
+		return
+	}
+
+	id, ok := strings.CutPrefix(r.URL.Path, h.basePath)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		h.create(w, r)
+	case id != "" && r.Method == http.MethodHead:
+		h.head(w, id)
+	case id != "" && r.Method == http.MethodPatch:
+		h.patch(w, r, id)
+	case id != "" && r.Method == http.MethodDelete:
+		h.terminate(w, id)
+	case id == "":
+		w.Header().Set("Allow", "OPTIONS, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		w.Header().Set("Allow", "OPTIONS, HEAD, PATCH, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) options(w http.ResponseWriter) {
+	w.Header().Set("Tus-Version", Version)
+	w.Header().Set("Tus-Extension", extensions)
+	if h.maxSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatUint(uint64(h.maxSize), 10))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if h.maxSize > 0 && formstream.DataSize(length) > h.maxSize {
+		http.Error(w, "upload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "invalid Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+
+	id, err := h.newID()
+	if err != nil {
+		http.Error(w, "failed to generate upload id", http.StatusInternalServerError)
+		return
+	}
+
+	var session resumable.Session
+	if store, ok := h.store.(resumable.MetadataStore); ok {
+		session, err = store.CreateWithMetadata(id, length, metadata)
+	} else {
+		session, err = h.store.Create(id, length)
+	}
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	w.Header().Set("Location", h.basePath+id)
+
+	if length == 0 {
+		err = h.complete(session)
+		if err != nil {
+			h.error(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handler) head(w http.ResponseWriter, id string) {
+	session, err := h.store.Get(id)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	offset, err := session.Offset()
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	if store, ok := h.store.(resumable.MetadataStore); ok {
+		metadata, err := store.Metadata(id)
+		if err != nil {
+			h.error(w, err)
+			return
+		}
+		if len(metadata) > 0 {
+			w.Header().Set("Upload-Metadata", formatMetadata(metadata))
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.TotalSize(), 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) patch(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("Content-Type") != offsetContentType {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.store.Get(id)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	// one more byte than the rest of the upload, so that Append detects the data exceeding it
+	body := formstream.NewBodyReader(r.Context(), http.MaxBytesReader(w, r.Body, session.TotalSize()-offset+1), h.parserOptions...)
+	defer body.Close()
+
+	newOffset, err := session.Append(offset, body)
+	if errors.Is(err, formstream.ErrClientTooSlow) {
+		// unblock the read of the body left running in background, which would keep the response from being sent
+		_ = http.NewResponseController(w).SetReadDeadline(time.Now())
+	}
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	if newOffset == session.TotalSize() {
+		err = h.complete(session)
+		if err != nil {
+			h.error(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) terminate(w http.ResponseWriter, id string) {
+	err := h.store.Remove(id)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// complete runs the completion hook and removes the upload.
+func (h *Handler) complete(session resumable.Session) error {
+	var metadata map[string]string
+	if store, ok := h.store.(resumable.MetadataStore); ok {
+		var err error
+		metadata, err = store.Metadata(session.ID())
+		if err != nil {
+			return err
+		}
+	}
+
+	return resumable.Complete(h.store, session, uploadHeader(metadata), h.onComplete)
+}
+
+// uploadHeader returns the header of the upload as a form file.
+func uploadHeader(metadata map[string]string) formstream.Header {
+	params := map[string]string{"name": "file"}
+	if filename, ok := metadata["filename"]; ok {
+		params["filename"] = filename
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", mime.FormatMediaType("form-data", params))
+	if filetype, ok := metadata["filetype"]; ok {
+		header.Set("Content-Type", filetype)
+	}
+
+	return formstream.NewHeader(header)
+}
+
+func (h *Handler) error(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, resumable.ErrSessionNotFound), errors.Is(err, resumable.ErrInvalidID):
+		http.Error(w, "upload not found", http.StatusNotFound)
+	case errors.Is(err, resumable.ErrOffsetMismatch):
+		http.Error(w, "offset mismatch", http.StatusConflict)
+	case errors.Is(err, resumable.ErrTooLarge):
+		http.Error(w, "upload too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, resumable.ErrCompleting):
+		http.Error(w, "upload is being completed", http.StatusLocked)
+	default:
+		// the errors of reading the body, e.g. the client too slow, or the errors of the server
+		http.Error(w, formstream.StatusMessage(err), formstream.StatusCode(err))
+	}
+}
+
+// parseMetadata parses the Upload-Metadata header: comma-separated pairs of a key and a base64 encoded value.
+func parseMetadata(s string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(s) == "" {
+		return metadata, nil
+	}
+
+	for pair := range strings.SplitSeq(s, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty metadata key")
+		}
+
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode metadata(%s): %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
+
+func formatMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		if value == "" {
+			pairs = append(pairs, key)
+			continue
+		}
+
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,351 @@
+package tus_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mazrean/formstream"
+	"github.com/mazrean/formstream/resumable"
+	"github.com/mazrean/formstream/tus"
+)
+
+type request struct {
+	method  string
+	path    string
+	headers map[string]string
+	body    string
+}
+
+type response struct {
+	status  int
+	headers map[string]string
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("video.mp4")) +
+		",filetype " + base64.StdEncoding.EncodeToString([]byte("video/mp4"))
+
+	store, err := resumable.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var completed []string
+	handler := tus.NewHandler(store, func(r io.Reader, header formstream.Header) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		completed = append(completed, header.Name()+":"+header.FileName()+":"+header.ContentType()+":"+string(data))
+
+		return nil
+	}, tus.WithBasePath("/files"), tus.WithMaxSize(100), tus.WithIDGenerator(func() (string, error) {
+		return "upload", nil
+	}))
+
+	steps := []struct {
+		request  request
+		response response
+	}{
+		{
+			request: request{method: http.MethodOptions, path: "/files/"},
+			response: response{status: http.StatusNoContent, headers: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Tus-Version":   "1.0.0",
+				"Tus-Extension": "creation,termination",
+				"Tus-Max-Size":  "100",
+			}},
+		},
+		{
+			request:  request{method: http.MethodPost, path: "/files/", headers: map[string]string{"Upload-Length": "9"}},
+			response: response{status: http.StatusPreconditionFailed, headers: map[string]string{"Tus-Version": "1.0.0"}},
+		},
+		{
+			request: request{method: http.MethodPost, path: "/files/", headers: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "101",
+			}},
+			response: response{status: http.StatusRequestEntityTooLarge},
+		},
+		{
+			request: request{method: http.MethodPost, path: "/files/", headers: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			}},
+			response: response{status: http.StatusBadRequest},
+		},
+		{
+			request: request{method: http.MethodPost, path: "/files/", headers: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "9",
+				"Upload-Metadata": metadata,
+			}},
+			response: response{status: http.StatusCreated, headers: map[string]string{"Location": "/files/upload"}},
+		},
+		{
+			request: request{method: http.MethodPatch, path: "/files/upload", headers: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Offset": "0",
+				"Content-Type":  "application/offset+octet-stream",
+			}, body: "aaa"},
+			response: response{status: http.StatusNoContent, headers: map[string]string{"Upload-Offset": "3"}},
+		},
+		{
+			request: request{method: http.MethodHead, path: "/files/upload", headers: map[string]string{"Tus-Resumable": "1.0.0"}},
+			response: response{status: http.StatusOK, headers: map[string]string{
+				"Upload-Offset": "3",
+				"Upload-Length": "9",
+				"Cache-Control": "no-store",
+			}},
+		},
+		{
+			request: request{method: http.MethodPatch, path: "/files/upload", headers: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Offset": "0",
+				"Content-Type":  "application/offset+octet-stream",
+			}, body: "bbb"},
+			response: response{status: http.StatusConflict},
+		},
+		{
+			request: request{method: http.MethodPatch, path: "/files/upload", headers: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Offset": "3",
+				"Content-Type":  "text/plain",
+			}, body: "bbb"},
+			response: response{status: http.StatusUnsupportedMediaType},
+		},
+		{
+			request: request{method: http.MethodPatch, path: "/files/upload", headers: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Offset": "3",
+				"Content-Type":  "application/offset+octet-stream",
+			}, body: "bbbccccc"},
+			response: response{status: http.StatusRequestEntityTooLarge},
+		},
+		{
+			request: request{method: http.MethodPatch, path: "/files/upload", headers: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Offset": "3",
+				"Content-Type":  "application/offset+octet-stream",
+			}, body: "bbbccc"},
+			response: response{status: http.StatusNoContent, headers: map[string]string{"Upload-Offset": "9"}},
+		},
+		{
+			request:  request{method: http.MethodHead, path: "/files/upload", headers: map[string]string{"Tus-Resumable": "1.0.0"}},
+			response: response{status: http.StatusNotFound},
+		},
+		{
+			request: request{method: http.MethodPost, path: "/files/", headers: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "9",
+			}},
+			response: response{status: http.StatusCreated},
+		},
+		{
+			request:  request{method: http.MethodDelete, path: "/files/upload", headers: map[string]string{"Tus-Resumable": "1.0.0"}},
+			response: response{status: http.StatusNoContent},
+		},
+		{
+			request:  request{method: http.MethodDelete, path: "/files/upload", headers: map[string]string{"Tus-Resumable": "1.0.0"}},
+			response: response{status: http.StatusNotFound},
+		},
+		{
+			request:  request{method: http.MethodGet, path: "/files/upload", headers: map[string]string{"Tus-Resumable": "1.0.0"}},
+			response: response{status: http.StatusMethodNotAllowed},
+		},
+	}
+
+	for i, step := range steps {
+		req := httptest.NewRequest(step.request.method, step.request.path, strings.NewReader(step.request.body))
+		for key, value := range step.request.headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != step.response.status {
+			t.Fatalf("step %d: unexpected status: %d %s", i, rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("Tus-Resumable") != tus.Version {
+			t.Errorf("step %d: missing Tus-Resumable", i)
+		}
+		for key, value := range step.response.headers {
+			if actual := rec.Header().Get(key); actual != value {
+				t.Errorf("step %d: unexpected %s: %s", i, key, actual)
+			}
+		}
+	}
+
+	if len(completed) != 1 || completed[0] != "file:video.mp4:video/mp4:aaabbbccc" {
+		t.Errorf("unexpected completed uploads: %v", completed)
+	}
+}
+
+func TestHandler_completion(t *testing.T) {
+	t.Parallel()
+
+	store, err := resumable.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	handler := tus.NewHandler(store, func(r io.Reader, _ formstream.Header) error {
+		calls++
+		if calls == 1 {
+			return errors.New("hook error")
+		}
+
+		close(started)
+		<-finish
+
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}, tus.WithIDGenerator(func() (string, error) {
+		return "upload", nil
+	}))
+
+	serve := func(method, offset, body string) *httptest.ResponseRecorder {
+		path := "/upload"
+		if method == http.MethodPost {
+			path = "/"
+		}
+
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Tus-Resumable", tus.Version)
+		switch method {
+		case http.MethodPost:
+			req.Header.Set("Upload-Length", "3")
+		case http.MethodPatch:
+			req.Header.Set("Upload-Offset", offset)
+			req.Header.Set("Content-Type", "application/offset+octet-stream")
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	if rec := serve(http.MethodPost, "", ""); rec.Code != http.StatusCreated {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+
+	// the upload is kept when the completion hook fails
+	if rec := serve(http.MethodPatch, "0", "aaa"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if rec := serve(http.MethodHead, "", ""); rec.Code != http.StatusOK || rec.Header().Get("Upload-Offset") != "3" {
+		t.Fatalf("unexpected status: %d, offset: %s", rec.Code, rec.Header().Get("Upload-Offset"))
+	}
+
+	// an empty PATCH at the end retries the completion
+	done := make(chan int, 1)
+	go func() {
+		done <- serve(http.MethodPatch, "3", "").Code
+	}()
+	<-started
+
+	// the completion runs only once
+	if rec := serve(http.MethodPatch, "3", ""); rec.Code != http.StatusLocked {
+		t.Errorf("unexpected status: %d", rec.Code)
+	}
+
+	close(finish)
+	if code := <-done; code != http.StatusNoContent {
+		t.Errorf("unexpected status: %d", code)
+	}
+
+	if calls != 2 {
+		t.Errorf("unexpected calls: %d", calls)
+	}
+	if rec := serve(http.MethodHead, "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unexpected status: %d", rec.Code)
+	}
+}
+
+func TestHandler_limits(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		// interval the interval between the bytes the client sends
+		interval       time.Duration
+		canceled       bool
+		expectedStatus int
+	}{
+		"normal": {
+			expectedStatus: http.StatusNoContent,
+		},
+		"idle": {
+			interval:       time.Second,
+			expectedStatus: http.StatusRequestTimeout,
+		},
+		"canceled": {
+			canceled:       true,
+			expectedStatus: formstream.StatusClientClosedRequest,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			store, err := resumable.NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = store.Create("upload", 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler := tus.NewHandler(store, func(r io.Reader, _ formstream.Header) error {
+				_, err := io.Copy(io.Discard, r)
+				return err
+			}, tus.WithParserOptions(formstream.WithIdleTimeout(50*time.Millisecond)))
+
+			pr, pw := io.Pipe()
+			go func() {
+				for range 3 {
+					_, err := pw.Write([]byte("a"))
+					if err != nil {
+						return
+					}
+					time.Sleep(tt.interval)
+				}
+				pw.Close()
+			}()
+			defer pr.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.canceled {
+				cancel()
+			}
+
+			req := httptest.NewRequestWithContext(ctx, http.MethodPatch, "/upload", pr)
+			req.Header.Set("Tus-Resumable", tus.Version)
+			req.Header.Set("Upload-Offset", "0")
+			req.Header.Set("Content-Type", "application/offset+octet-stream")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("unexpected status: %d %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
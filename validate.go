@@ -0,0 +1,173 @@
+package formstream
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	conditionjudge "github.com/mazrean/formstream/internal/condition_judge"
+)
+
+// DependencyProblem is the reason why a requirement of a stream hook is invalid.
+type DependencyProblem int
+
+const (
+	// DependencySelf the stream hook requires its own part or result.
+	DependencySelf DependencyProblem = iota + 1
+	// DependencyCycle the stream hooks require the parts or the results of each other.
+	DependencyCycle
+	// DependencyUnresolvable the required stream hook is not registered or never runs.
+	DependencyUnresolvable
+)
+
+func (p DependencyProblem) String() string {
+	switch p {
+	case DependencySelf:
+		return "self requirement"
+	case DependencyCycle:
+		return "cycle"
+	case DependencyUnresolvable:
+		return "unresolvable"
+	}
+
+	return fmt.Sprintf("DependencyProblem(%d)", int(p))
+}
+
+// DependencyEdge is a requirement of a stream hook.
+type DependencyEdge struct {
+	// Hook the name of the stream hook.
+	Hook string
+	// Required the name of the required part or stream hook.
+	Required string
+	// Result whether the result of the stream hook is required instead of the part.
+	Result bool
+	// Problem why the requirement is invalid.
+	Problem DependencyProblem
+}
+
+func (e DependencyEdge) String() string {
+	kind := "part"
+	if e.Result {
+		kind = "result"
+	}
+
+	return fmt.Sprintf("%s -> %s(%s): %s", e.Hook, e.Required, kind, e.Problem)
+}
+
+// DependencyGraphError is returned when the requirements of the stream hooks can not be satisfied as intended.
+type DependencyGraphError struct {
+	// Edges the invalid requirements.
+	Edges []DependencyEdge
+}
+
+func (e DependencyGraphError) Error() string {
+	edges := make([]string, 0, len(e.Edges))
+	for _, edge := range e.Edges {
+		edges = append(edges, edge.String())
+	}
+
+	return fmt.Sprintf("invalid dependency graph: %s", strings.Join(edges, ", "))
+}
+
+// Validate checks the requirements of the registered stream hooks.
+// It returns DependencyGraphError listing the invalid requirements, which would make the hooks silently skipped
+// or run in an unintended order.
+// Only the requirements that must be met are checked, so the alternatives of AnyOf are not reported.
+//
+// The requirements of parts (a hook requiring its own part, cycles between hooked parts) are only reported by Validate,
+// because the hooks still run after their parts are buffered.
+// Parse checks the requirements of results at the start, since they can block the hooks.
+func (p *Parser) Validate() error {
+	return p.validate(true)
+}
+
+// validate checks the requirements of the stream hooks.
+// The requirements of parts are checked only if parts is true.
+func (p *Parser) validate(parts bool) error {
+	var edges []DependencyEdge
+	graph := make(map[string][]string, len(p.hookMap))
+	for _, name := range slices.Sorted(maps.Keys(p.hookMap)) {
+		hook := p.hookMap[name]
+		graph[name] = nil
+
+		if parts {
+			names := append(slices.Clone(hook.requireParts), mandatoryRequirementNames(hook.requirements)...)
+			for _, required := range uniqueSorted(names) {
+				edges = append(edges, DependencyEdge{Hook: name, Required: required})
+				if _, ok := p.hookMap[required]; ok && required != name {
+					graph[name] = append(graph[name], required)
+				}
+			}
+		}
+
+		for _, required := range uniqueSorted(mandatoryRequirementResults(hook.requirements)) {
+			edges = append(edges, DependencyEdge{Hook: name, Required: required, Result: true})
+			if _, ok := p.hookMap[required]; ok && required != name {
+				graph[name] = append(graph[name], required)
+			}
+		}
+	}
+
+	componentMap := make(map[string]int, len(graph))
+	for i, component := range conditionjudge.StronglyConnectedComponents(graph) {
+		if len(component) < 2 {
+			continue
+		}
+
+		for _, name := range component {
+			componentMap[name] = i + 1
+		}
+	}
+
+	unresolvable := make(map[string]bool)
+	for i, edge := range edges {
+		_, isHook := p.hookMap[edge.Required]
+		switch {
+		case edge.Required == edge.Hook:
+			edges[i].Problem = DependencySelf
+		case componentMap[edge.Hook] != 0 && componentMap[edge.Hook] == componentMap[edge.Required]:
+			edges[i].Problem = DependencyCycle
+		case edge.Result && !isHook:
+			edges[i].Problem = DependencyUnresolvable
+		default:
+			continue
+		}
+
+		if edge.Result {
+			unresolvable[edge.Hook] = true
+		}
+	}
+
+	// the hooks requiring the results of unresolvable hooks are also unresolvable
+	for changed := true; changed; {
+		changed = false
+		for i, edge := range edges {
+			if !edge.Result || edge.Problem != 0 || !unresolvable[edge.Required] {
+				continue
+			}
+
+			edges[i].Problem = DependencyUnresolvable
+			if !unresolvable[edge.Hook] {
+				unresolvable[edge.Hook] = true
+				changed = true
+			}
+		}
+	}
+
+	edges = slices.DeleteFunc(edges, func(edge DependencyEdge) bool {
+		return edge.Problem == 0
+	})
+	if len(edges) != 0 {
+		return DependencyGraphError{Edges: edges}
+	}
+
+	return nil
+}
+
+func uniqueSorted(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+
+	return slices.Compact(s)
+}
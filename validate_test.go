@@ -0,0 +1,198 @@
+package formstream_test
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mazrean/formstream"
+)
+
+func TestParser_Validate(t *testing.T) {
+	t.Parallel()
+
+	nop := func(io.Reader, formstream.Header) error { return nil }
+
+	type hook struct {
+		name    string
+		options []formstream.RegisterOption
+	}
+	tests := map[string]struct {
+		hooks []hook
+		edges []formstream.DependencyEdge
+	}{
+		"valid": {
+			hooks: []hook{
+				{"a", []formstream.RegisterOption{formstream.WithRequiredPart("field")}},
+				{"b", []formstream.RegisterOption{formstream.WithRequiredResult("a"), formstream.WithRequiredPart("a")}},
+			},
+		},
+		"self part": {
+			hooks: []hook{
+				{"a", []formstream.RegisterOption{formstream.WithRequiredPart("a")}},
+			},
+			edges: []formstream.DependencyEdge{
+				{Hook: "a", Required: "a", Problem: formstream.DependencySelf},
+			},
+		},
+		"part cycle": {
+			hooks: []hook{
+				{"a", []formstream.RegisterOption{formstream.WithRequiredPart("b")}},
+				{"b", []formstream.RegisterOption{formstream.WithRequiredPart("a")}},
+			},
+			edges: []formstream.DependencyEdge{
+				{Hook: "a", Required: "b", Problem: formstream.DependencyCycle},
+				{Hook: "b", Required: "a", Problem: formstream.DependencyCycle},
+			},
+		},
+		"part and result cycle": {
+			hooks: []hook{
+				{"a", []formstream.RegisterOption{formstream.WithRequiredResult("b")}},
+				{"b", []formstream.RegisterOption{formstream.WithRequiredPart("a")}},
+			},
+			edges: []formstream.DependencyEdge{
+				{Hook: "a", Required: "b", Result: true, Problem: formstream.DependencyCycle},
+				{Hook: "b", Required: "a", Problem: formstream.DependencyCycle},
+			},
+		},
+		"unregistered result": {
+			hooks: []hook{
+				{"a", []formstream.RegisterOption{formstream.WithRequiredResult("b")}},
+			},
+			edges: []formstream.DependencyEdge{
+				{Hook: "a", Required: "b", Result: true, Problem: formstream.DependencyUnresolvable},
+			},
+		},
+		"unresolvable chain": {
+			hooks: []hook{
+				{"a", []formstream.RegisterOption{formstream.WithRequiredResult("b")}},
+				{"b", []formstream.RegisterOption{formstream.WithRequiredResult("c")}},
+				{"d", []formstream.RegisterOption{formstream.WithRequiredPart("b")}},
+			},
+			edges: []formstream.DependencyEdge{
+				{Hook: "a", Required: "b", Result: true, Problem: formstream.DependencyUnresolvable},
+				{Hook: "b", Required: "c", Result: true, Problem: formstream.DependencyUnresolvable},
+			},
+		},
+		"any is not checked": {
+			hooks: []hook{
+				{"a", []formstream.RegisterOption{formstream.WithRequirement(formstream.AnyOf(
+					formstream.HookResult("b"),
+					formstream.Part("a"),
+				))}},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			parser := formstream.NewParser(boundary)
+			for _, h := range tt.hooks {
+				err := parser.Register(h.name, nop, h.options...)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := parser.Validate()
+
+			var graphErr formstream.DependencyGraphError
+			if !errors.As(err, &graphErr) {
+				if tt.edges != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if !slices.Equal(graphErr.Edges, tt.edges) {
+				t.Errorf("unexpected edges: expected %v, actual %v", tt.edges, graphErr.Edges)
+			}
+		})
+	}
+}
+
+func TestParsePartRequirements(t *testing.T) {
+	t.Parallel()
+
+	body := "--boundary\r\n" +
+		"Content-Disposition: form-data; name=\"a\"\r\n\r\n" +
+		"AAA\r\n" +
+		"--boundary\r\n" +
+		"Content-Disposition: form-data; name=\"b\"\r\n\r\n" +
+		"BBB\r\n" +
+		"--boundary--\r\n"
+
+	type hook struct {
+		name    string
+		options []formstream.RegisterOption
+	}
+	tests := map[string]struct {
+		hooks    []hook
+		expected map[string]string
+		isErr    bool
+	}{
+		"part cycle": {
+			hooks: []hook{
+				{"a", []formstream.RegisterOption{formstream.WithRequiredPart("b")}},
+				{"b", []formstream.RegisterOption{formstream.WithRequiredPart("a")}},
+			},
+			expected: map[string]string{"a": "AAA", "b": "BBB"},
+		},
+		"self part": {
+			hooks: []hook{
+				{"a", []formstream.RegisterOption{formstream.WithRequiredPart("a")}},
+			},
+			expected: map[string]string{"a": "AAA"},
+		},
+		"unregistered result": {
+			hooks: []hook{
+				{"a", []formstream.RegisterOption{formstream.WithRequiredResult("c")}},
+			},
+			expected: map[string]string{},
+			isErr:    true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			parser := formstream.NewParser(boundary)
+
+			contents := map[string]string{}
+			for _, h := range tt.hooks {
+				err := parser.Register(h.name, func(r io.Reader, _ formstream.Header) error {
+					b, err := io.ReadAll(r)
+					if err != nil {
+						return err
+					}
+					contents[h.name] = string(b)
+
+					return nil
+				}, h.options...)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := parser.Parse(strings.NewReader(body))
+
+			var graphErr formstream.DependencyGraphError
+			if tt.isErr != errors.As(err, &graphErr) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.isErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !maps.Equal(contents, tt.expected) {
+				t.Errorf("unexpected contents: expected %v, actual %v", tt.expected, contents)
+			}
+		})
+	}
+}
@@ -38,3 +38,13 @@ func (p *Parser) Values(key string) ([]Value, bool) {
 func (p *Parser) ValueMap() map[string][]Value {
 	return p.valueMap
 }
+
+// Result first result of the stream hook registered with RegisterWithResult.
+func (p *Parser) Result(name string) (any, bool) {
+	results := p.resultMap[name]
+	if len(results) == 0 {
+		return nil, false
+	}
+
+	return results[0], true
+}
@@ -0,0 +1,84 @@
+package formstream
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotBuffered is returned when ZipHook gets a part that is not buffered, i.e. the hook is registered without WithForceSpool.
+var ErrNotBuffered = errors.New("part is not buffered")
+
+// zipContent is the reader of a buffered part.
+type zipContent interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+// ZipHook returns a hook that calls fn with the zip archive in the part.
+// Zip needs random access, so the hook must be registered with WithForceSpool; otherwise it fails with ErrNotBuffered.
+// The names of the files are cleaned, and the archive is rejected with ErrUnsafeEntry
+// if an entry escapes the archive root or is not a regular file or directory.
+// The limits of the ArchiveOption are checked against the sizes declared in the archive, before fn is called.
+// archive/zip fails reading an entry larger than declared.
+func ZipHook(fn func(zr *zip.Reader, header Header) error, options ...ArchiveOption) StreamHookFunc {
+	c := newArchiveConfig(options)
+
+	return func(r io.Reader, header Header) error {
+		content, ok := r.(zipContent)
+		if !ok {
+			return fmt.Errorf("%w: register the hook with WithForceSpool", ErrNotBuffered)
+		}
+
+		size, err := content.Seek(0, io.SeekEnd)
+		if err != nil {
+			return fmt.Errorf("failed to get size: %w", err)
+		}
+
+		zr, err := zip.NewReader(content, size)
+		if err != nil {
+			return fmt.Errorf("failed to read zip: %w", err)
+		}
+
+		err = c.checkZip(zr)
+		if err != nil {
+			return err
+		}
+
+		// the content is read through io.ReaderAt, so the offset stays at the end and the part counts as consumed
+		return fn(zr, header)
+	}
+}
+
+func (c *archiveConfig) checkZip(zr *zip.Reader) error {
+	if uint(len(zr.File)) > c.maxEntries {
+		return ErrTooManyEntries
+	}
+
+	var totalSize uint64
+	for _, f := range zr.File {
+		totalSize += f.UncompressedSize64
+		if totalSize > uint64(c.maxTotalSize) {
+			return ErrArchiveTooLarge
+		}
+
+		if c.maxCompressionRatio > 0 && f.CompressedSize64 > 0 &&
+			float64(f.UncompressedSize64)/float64(f.CompressedSize64) > c.maxCompressionRatio {
+			return fmt.Errorf("%w: compression ratio of %s is too high", ErrArchiveTooLarge, f.Name)
+		}
+
+		mode := f.Mode()
+		if !mode.IsRegular() && !mode.IsDir() {
+			return fmt.Errorf("%w: %s is not a regular file or directory", ErrUnsafeEntry, f.Name)
+		}
+
+		name, err := sanitizeEntryName(f.Name)
+		if err != nil {
+			return err
+		}
+		f.Name = name
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package formstream_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mazrean/formstream"
+)
+
+type zipEntry struct {
+	name    string
+	content string
+	method  uint16
+}
+
+func createZip(t *testing.T, entries []zipEntry) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, entry := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:   entry.name,
+			Method: entry.method,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write([]byte(entry.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestZipHook(t *testing.T) {
+	t.Parallel()
+
+	files := []zipEntry{
+		{name: "dir/a.txt", content: "aaa"},
+		{name: "./b.txt", content: "bbbbb", method: zip.Deflate},
+	}
+
+	tests := map[string]struct {
+		entries  []zipEntry
+		options  []formstream.ArchiveOption
+		expected []string
+		err      error
+	}{
+		"normal": {
+			entries:  files,
+			expected: []string{"dir/a.txt:aaa", "b.txt:bbbbb"},
+		},
+		"too many entries": {
+			entries: files,
+			options: []formstream.ArchiveOption{formstream.WithMaxEntries(1)},
+			err:     formstream.ErrTooManyEntries,
+		},
+		"too large": {
+			entries: files,
+			options: []formstream.ArchiveOption{formstream.WithMaxTotalSize(7)},
+			err:     formstream.ErrArchiveTooLarge,
+		},
+		"compression ratio": {
+			entries: []zipEntry{{name: "bomb.txt", content: strings.Repeat("a", 10000), method: zip.Deflate}},
+			err:     formstream.ErrArchiveTooLarge,
+		},
+		"compression ratio(allowed)": {
+			entries:  []zipEntry{{name: "bomb.txt", content: strings.Repeat("a", 10000), method: zip.Deflate}},
+			options:  []formstream.ArchiveOption{formstream.WithMaxCompressionRatio(1000)},
+			expected: []string{"bomb.txt:" + strings.Repeat("a", 10000)},
+		},
+		"path traversal": {
+			entries: []zipEntry{{name: "../a.txt", content: "aaa"}},
+			err:     formstream.ErrUnsafeEntry,
+		},
+		"absolute path": {
+			entries: []zipEntry{{name: "/a.txt", content: "aaa"}},
+			err:     formstream.ErrUnsafeEntry,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			data := createZip(t, tt.entries)
+
+			sb := &strings.Builder{}
+			mw := multipart.NewWriter(sb)
+			err := mw.SetBoundary(boundary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw, err := mw.CreateFormFile("bundle", "bundle.zip")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = fw.Write(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parser := formstream.NewParser(boundary, formstream.WithStrictOrder(), formstream.WithUnconsumedPolicy(formstream.FailUnconsumed))
+
+			var actual []string
+			err = parser.Register("bundle", formstream.ZipHook(func(zr *zip.Reader, _ formstream.Header) error {
+				for _, f := range zr.File {
+					r, err := f.Open()
+					if err != nil {
+						return err
+					}
+
+					content, err := io.ReadAll(r)
+					if err != nil {
+						return err
+					}
+
+					actual = append(actual, f.Name+":"+string(content))
+				}
+
+				return nil
+			}, tt.options...), formstream.WithForceSpool())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parser.Parse(strings.NewReader(sb.String()))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(actual, tt.expected) {
+				t.Errorf("unexpected entries: %v", actual)
+			}
+		})
+	}
+}
+
+func TestZipHook_notBuffered(t *testing.T) {
+	t.Parallel()
+
+	hook := formstream.ZipHook(func(*zip.Reader, formstream.Header) error {
+		return nil
+	})
+
+	err := hook(io.MultiReader(bytes.NewReader(createZip(t, nil))), formstream.Header{})
+	if !errors.Is(err, formstream.ErrNotBuffered) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}